@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// maxTermAlt limits the altitude used in the azimuth terms, tan(alt) grows without limit towards the zenith where the
+// azimuth axis hardly moves the normal, so a tiny tilt would otherwise ask for an arbitrary azimuth move(e.g. when stowing flat)
+const maxTermAlt = 80 * math.Pi / 180
+
+// pointingTerms returns the basis terms of the pointing model for a mirror normal direction(radians), for each axis.
+// The order matches the model's terms: AziZero, AltZero, TiltA, TiltB, NonPerp
+func pointingTerms(azi float64, alt float64) ([5]float64, [5]float64) {
+	tanAlt := math.Tan(math.Max(-maxTermAlt, math.Min(maxTermAlt, alt)))
+	aziTerms := [5]float64{1, 0, math.Sin(azi) * tanAlt, -math.Cos(azi) * tanAlt, tanAlt}
+	altTerms := [5]float64{0, 1, math.Cos(azi), math.Sin(azi), 0}
+	return aziTerms, altTerms
+}
+
+func modelTerms(m sun.PointingModel) [5]float64 {
+	return [5]float64{m.AziZero, m.AltZero, m.TiltA, m.TiltB, m.NonPerp}
+}
+
+// modelCorrection returns the correction(radians) to add to each axis to point the mirror's normal at azi/alt
+func modelCorrection(m sun.PointingModel, azi float64, alt float64) (float64, float64) {
+	aziTerms, altTerms := pointingTerms(azi, alt)
+	p := modelTerms(m)
+	dAzi, dAlt := 0.0, 0.0
+	for i := range p {
+		dAzi += aziTerms[i] * p[i]
+		dAlt += altTerms[i] * p[i]
+	}
+	return dAzi, dAlt
+}
+
+// pointingCorrection returns the calibrated correction for the mirror normal direction, nothing if calibration isn't enabled
+func (c *Controller) pointingCorrection(azi float64, alt float64) (float64, float64) {
+	if !c.activeConfig.Calibration.Enabled {
+		return 0, 0
+	}
+	return modelCorrection(c.activeConfig.Calibration.Model, azi, alt)
+}
+
+// fitPointingModel finds the model that best explains(least squares) the difference between where the axes were observed to be
+// and where the offsets alone would have put them. Offsets are in radians, the model applies relative to the mount's base
+func fitPointingModel(obs []sun.Observation, aziOffset float64, altOffset float64, base sun.Base) (sun.PointingModel, error) {
+	if len(obs) < 3 {
+		return sun.PointingModel{}, fmt.Errorf("need at least 3 observations to fit, have %d", len(obs))
+	}
+	//normal equations, ata * p = atb
+	var ata [5][5]float64
+	var atb [5]float64
+	residuals := make([][2]float64, 0, len(obs))
+	add := func(terms [5]float64, r float64) {
+		for i := range terms {
+			for j := range terms {
+				ata[i][j] += terms[i] * terms[j]
+			}
+			atb[i] += terms[i] * r
+		}
+	}
+	mirrors := make([]sun.Direction, len(obs))
+	for i, o := range obs {
+		mirror := toMountFrame(o.Mirror, base)
+		mirrors[i] = mirror
+		rAzi := math.Remainder(degToRad(o.AxesAzi)-(mirror.Azimuth-aziOffset), 2*math.Pi)
+		rAlt := degToRad(o.AxesAlt) - (mirror.Altitude - altOffset)
+		aziTerms, altTerms := pointingTerms(mirror.Azimuth, mirror.Altitude)
+		add(aziTerms, rAzi)
+		add(altTerms, rAlt)
+		residuals = append(residuals, [2]float64{rAzi, rAlt})
+	}
+	p, err := solve(ata, atb)
+	if err != nil {
+		return sun.PointingModel{}, fmt.Errorf("observations don't pin down the model, record points spread across the sky: %v", err)
+	}
+	m := sun.PointingModel{AziZero: p[0], AltZero: p[1], TiltA: p[2], TiltB: p[3], NonPerp: p[4]}
+
+	//how well does the model explain the observations
+	sum := 0.0
+	for i, mirror := range mirrors {
+		dAzi, dAlt := modelCorrection(m, mirror.Azimuth, mirror.Altitude)
+		sum += math.Pow(residuals[i][0]-dAzi, 2) + math.Pow(residuals[i][1]-dAlt, 2)
+	}
+	m.RMS = math.Sqrt(sum / float64(2*len(obs)))
+	return m, nil
+}
+
+// solve solves a*x = b by gaussian elimination with partial pivoting
+func solve(a [5][5]float64, b [5]float64) ([5]float64, error) {
+	var x [5]float64
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return x, fmt.Errorf("singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+	for row := n - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, nil
+}
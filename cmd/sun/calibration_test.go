@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// observations the mount would produce if it followed the model, at mirror normals spread over the sky
+func synthesiseObservations(m types.PointingModel, aziOffset float64, altOffset float64) []types.Observation {
+	obs := []types.Observation{}
+	for _, azi := range []float64{-2.5, -1.2, -0.3, 0.4, 1.1, 2.2} {
+		for _, alt := range []float64{0.2, 0.6, 1.0} {
+			dAzi, dAlt := modelCorrection(m, azi, alt)
+			obs = append(obs, types.Observation{
+				Mirror:  types.Direction{Azimuth: azi, Altitude: alt},
+				AxesAzi: radToDeg(azi - aziOffset + dAzi),
+				AxesAlt: radToDeg(alt - altOffset + dAlt),
+			})
+		}
+	}
+	return obs
+}
+
+func TestFitPointingModel(tt *testing.T) {
+	expect := types.PointingModel{AziZero: 0.02, AltZero: -0.01, TiltA: 0.005, TiltB: -0.008, NonPerp: 0.003}
+	obs := synthesiseObservations(expect, 0.1, -0.05)
+	m, err := fitPointingModel(obs, 0.1, -0.05, types.Base{})
+	if err != nil {
+		tt.Fatalf("Error with TestFitPointingModel, unexpected error: %v", err)
+	}
+	got := modelTerms(m)
+	for i, e := range modelTerms(expect) {
+		if math.Abs(got[i]-e) > 1e-9 {
+			tt.Errorf("Error with TestFitPointingModel, term %d... Got: %v expected: %v", i, got[i], e)
+		}
+	}
+	if m.RMS > 1e-9 {
+		tt.Errorf("Error with TestFitPointingModel, rms... Got: %v expected: 0", m.RMS)
+	}
+
+	//too few, or all at the same spot, can't be fitted
+	if _, err := fitPointingModel(obs[:2], 0.1, -0.05, types.Base{}); err == nil {
+		tt.Errorf("Error with TestFitPointingModel, expected an error with 2 observations")
+	}
+	same := []types.Observation{obs[0], obs[0], obs[0], obs[0]}
+	if _, err := fitPointingModel(same, 0.1, -0.05, types.Base{}); err == nil {
+		tt.Errorf("Error with TestFitPointingModel, expected an error with repeated observations")
+	}
+}
+
+func TestModelCorrectionNearZenith(tt *testing.T) {
+	m := types.PointingModel{NonPerp: 0.001, TiltA: 0.001}
+	for _, alt := range []float64{math.Pi / 2, math.Pi/2 - 1e-3} {
+		dAzi, _ := modelCorrection(m, 0.3, alt)
+		if math.IsNaN(dAzi) || math.Abs(dAzi) > 0.02 {
+			tt.Errorf("Error with TestModelCorrectionNearZenith at alt %v... Got: %v expected: a small azimuth correction", alt, dAzi)
+		}
+	}
+}
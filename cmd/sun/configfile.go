@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// UseConfigFile loads the config from path, or creates it from the current config if it doesn't exist yet.
+// Afterwards changes made by clients are saved back to the file, and it's reloaded when it changes or on reload
+func (c *Controller) UseConfigFile(path string, reload <-chan os.Signal) error {
+	c.configPath = path
+	c.reload = reload
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Printf("No config file at %v, creating one with the defaults", path)
+		return c.saveConfig()
+	}
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	err = validateConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid config in %v: %v", path, err)
+	}
+	c.activeConfig = cfg
+	c.fileConfig = cfg
+	c.configModTime = modTime(path)
+	log.Printf("Loaded config from %v", path)
+	return nil
+}
+
+// readConfigFile reads a json config file, fields the file leaves out keep their default values
+func readConfigFile(path string) (sun.Config, error) {
+	cfg := defaultConfig()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("reading %v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes the active config to the config file, a temporary file is renamed over the old one so
+// the file is never left half written
+func (c *Controller) saveConfig() error {
+	if c.configPath == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(c.activeConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.configPath), ".heliostat-config-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //cleans up if we don't get as far as the rename
+	//temporary files are only readable by us, keep the permissions the operator gave the config file
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(c.configPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	err = tmp.Chmod(mode)
+	if err == nil {
+		_, err = tmp.Write(b)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), c.configPath)
+	if err != nil {
+		return err
+	}
+	c.fileConfig = c.activeConfig
+	c.configModTime = modTime(c.configPath)
+	log.Printf("Saved config to %v", c.configPath)
+	return nil
+}
+
+// persistConfig saves the config after a client has changed it, failures are logged, the change still applies until restart
+// the mirror is moved for the change straight away
+func (c *Controller) persistConfig() {
+	c.updateDue = true
+	err := c.saveConfig()
+	if err != nil {
+		log.Printf("Could not save config: %v", err)
+	}
+}
+
+// configFileChanged reports if the config file has been modified since it was last read or written
+func (c *Controller) configFileChanged() bool {
+	if c.configPath == "" {
+		return false
+	}
+	t := modTime(c.configPath)
+	return !t.IsZero() && !t.Equal(c.configModTime)
+}
+
+// reloadConfig re-reads the config file, if the new config can't be read or isn't valid the active config is kept
+func (c *Controller) reloadConfig() {
+	if c.configPath == "" {
+		return
+	}
+	c.configModTime = modTime(c.configPath)
+	cfg, err := readConfigFile(c.configPath)
+	if err == nil {
+		err = validateConfig(cfg)
+	}
+	if err != nil {
+		log.Printf("Config reload failed, keeping the active config: %v", err)
+		c.publish <- sun.NewMessage("Status", sun.NewStatus(fmt.Sprintf("config reload failed, keeping the active config: %v", err)))
+		return
+	}
+	//the override time keeps running, unless the file sets a new one
+	if cfg.OverrideTime.Equal(c.fileConfig.OverrideTime) {
+		cfg.OverrideTime = c.activeConfig.OverrideTime
+	}
+	old := c.activeConfig
+	c.activeConfig = cfg
+	c.fileConfig = cfg
+	c.updateDue = true
+	if !reflect.DeepEqual(old.Target, cfg.Target) {
+		c.slew = nil //the file's target replaces any slew in progress
+	}
+	log.Printf("Reloaded config from %v", c.configPath)
+	c.publish <- sun.NewMessage("Status", sun.NewStatus("config reloaded"))
+	c.HandleGetActiveConfig()
+	if scheduleChanged(old, cfg) {
+		c.applySchedule() //a rule is only applied if a different one is now active
+	}
+}
+
+// scheduleChanged reports if anything the schedule depends on differs between the configs
+func scheduleChanged(old, cfg sun.Config) bool {
+	return old.Location != cfg.Location || !reflect.DeepEqual(old.Schedule, cfg.Schedule)
+}
+
+// modTime returns the modification time of the file, or zero if it can't be read
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// mergeConfig applies a partial config(json) to a copy of cfg, returning the result and the fields the update set
+func mergeConfig(cfg sun.Config, patch []byte) (sun.Config, []string, error) {
+	var fields map[string]any
+	err := json.Unmarshal(patch, &fields)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("update must be a json object: %v", err)
+	}
+	//copy via json, so lists in the active config aren't modified in place
+	merged := sun.Config{}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return cfg, nil, err
+	}
+	err = json.Unmarshal(b, &merged)
+	if err != nil {
+		return cfg, nil, err
+	}
+	//fields present in the update replace the copied values, nested objects are merged. json would decode a list
+	//into the existing elements, keeping the fields the update leaves out, so lists are emptied first
+	clearPatchedLists(reflect.ValueOf(&merged).Elem(), fields)
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&merged)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("bad config update: %v", err)
+	}
+	changed := fieldPaths("", fields)
+	replaceTargetForm(&merged.Target, changed)
+	return merged, changed, nil
+}
+
+// replaceTargetForm clears the target's other forms when an update gives it as a direction, an enu offset or a geodetic
+// position, otherwise a direction would be hidden by the point it replaces
+func replaceTargetForm(t *sun.Target, changed []string) {
+	dir, enu, geo := false, false, false
+	for _, f := range changed {
+		switch {
+		case f == "target.azi" || f == "target.alt":
+			dir = true
+		case strings.HasPrefix(f, "target.enu"):
+			enu = true
+		case strings.HasPrefix(f, "target.geodetic"):
+			geo = true
+		}
+	}
+	switch {
+	case dir && !enu && !geo:
+		t.Local, t.Geodetic = nil, nil
+	case enu && !geo:
+		t.Geodetic = nil
+	case geo && !enu:
+		t.Local = nil
+	}
+}
+
+// targetPatched reports if an update changed where the target is
+func targetPatched(changed []string) bool {
+	for _, f := range changed {
+		if strings.HasPrefix(f, "target") && !strings.HasPrefix(f, "target.plane") {
+			return true
+		}
+	}
+	return false
+}
+
+// clearPatchedLists empties the lists in v(a struct) that the json object fields replaces, following nested objects
+func clearPatchedLists(v reflect.Value, fields map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, sf := v.Field(i), t.Field(i)
+		if sf.Anonymous && f.Kind() == reflect.Struct {
+			clearPatchedLists(f, fields) //embedded fields are at the same level
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "" {
+			name = sf.Name
+		}
+		for k, value := range fields {
+			if !strings.EqualFold(k, name) { //json matches field names case insensitively
+				continue
+			}
+			switch value := value.(type) {
+			case []any:
+				if f.Kind() == reflect.Slice {
+					f.Set(reflect.Zero(f.Type()))
+				}
+			case map[string]any:
+				if f.Kind() == reflect.Struct {
+					clearPatchedLists(f, value)
+				}
+			}
+		}
+	}
+}
+
+// fieldPaths lists the fields set in a json object, nested fields are joined with '.', e.g. "loc.lat"
+func fieldPaths(prefix string, fields map[string]any) []string {
+	paths := []string{}
+	for k, v := range fields {
+		if nested, ok := v.(map[string]any); ok && len(nested) > 0 {
+			paths = append(paths, fieldPaths(prefix+k+".", nested)...)
+			continue
+		}
+		paths = append(paths, prefix+k)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// validateConfig checks a config is usable before it's applied
+func validateConfig(cfg sun.Config) error {
+	if !finite(cfg.Location.Lat) || cfg.Location.Lat < -90 || cfg.Location.Lat > 90 {
+		return fmt.Errorf("loc.lat must be between -90 and 90, got %v", cfg.Location.Lat)
+	}
+	if !finite(cfg.Location.Long) || cfg.Location.Long < -180 || cfg.Location.Long > 180 {
+		return fmt.Errorf("loc.long must be between -180 and 180, got %v", cfg.Location.Long)
+	}
+	numbers := []struct {
+		name  string
+		value float64
+		min   float64
+	}{
+		{"progression_factor", cfg.TimeProgression, 0},
+		{"azimuth_offset", cfg.AziOffset, math.Inf(-1)},
+		{"altitude_offset", cfg.AltOffset, math.Inf(-1)},
+		{"target.azi", cfg.Target.Azimuth, math.Inf(-1)},
+		{"target.alt", cfg.Target.Altitude, -math.Pi / 2},
+		{"park.azi", cfg.Park.Azimuth, math.Inf(-1)},
+		{"park.alt", cfg.Park.Altitude, -math.Pi / 2},
+		{"stow.azi", cfg.Stow.Azimuth, math.Inf(-1)},
+		{"stow.alt", cfg.Stow.Altitude, -math.Pi / 2},
+		{"mount.azi_steps_per_deg", cfg.Mount.AziStepsPerDegree, 0},
+		{"mount.alt_steps_per_deg", cfg.Mount.AltStepsPerDegree, 0},
+		{"mount.dead_band", cfg.Mount.DeadBand, 0},
+		{"mount.unwind_at", cfg.Mount.UnwindAt, 0},
+		{"mount.azi_limits.min", cfg.Mount.AziLimits.Min, math.Inf(-1)},
+		{"mount.azi_limits.max", cfg.Mount.AziLimits.Max, math.Inf(-1)},
+		{"mount.alt_limits.min", cfg.Mount.AltLimits.Min, math.Inf(-1)},
+		{"mount.alt_limits.max", cfg.Mount.AltLimits.Max, math.Inf(-1)},
+		{"latency.fixed", float64(cfg.Latency.Fixed), 0},
+		{"latency.settle", float64(cfg.Latency.Settle), 0},
+		{"update_period.min", float64(cfg.UpdatePeriod.Min), 0},
+		{"update_period.max", float64(cfg.UpdatePeriod.Max), 0},
+		{"update_period.max_error", cfg.UpdatePeriod.MaxError, 0},
+		{"calibration.model.azi_zero", cfg.Calibration.Model.AziZero, math.Inf(-1)},
+		{"calibration.model.alt_zero", cfg.Calibration.Model.AltZero, math.Inf(-1)},
+		{"calibration.model.tilt_a", cfg.Calibration.Model.TiltA, math.Inf(-1)},
+		{"calibration.model.tilt_b", cfg.Calibration.Model.TiltB, math.Inf(-1)},
+		{"calibration.model.non_perp", cfg.Calibration.Model.NonPerp, math.Inf(-1)},
+		{"corrections.radius", cfg.Corrections.Radius, 0},
+		{"mount.base.roll", cfg.Mount.Base.Roll, -math.Pi / 2},
+		{"mount.base.pitch", cfg.Mount.Base.Pitch, -math.Pi / 2},
+		{"mount.base.yaw", cfg.Mount.Base.Yaw, math.Inf(-1)},
+		{"mount.mirror_offset", cfg.Mount.MirrorOffset, math.Inf(-1)},
+		{"target.distance", cfg.Target.Distance, 0},
+		{"ephemeris.pressure", cfg.Ephemeris.Pressure, 0},
+		{"ephemeris.temperature", cfg.Ephemeris.Temperature, -273},
+		{"ephemeris.delta_t", cfg.Ephemeris.DeltaT, math.Inf(-1)},
+		{"source.dir.azi", cfg.Source.Direction.Azimuth, math.Inf(-1)},
+		{"source.dir.alt", cfg.Source.Direction.Altitude, -math.Pi / 2},
+		{"mirror.width", cfg.Mirror.Width, 0},
+		{"mirror.height", cfg.Mirror.Height, 0},
+		{"mirror.reflectivity", cfg.Mirror.Reflectivity, 0},
+		{"source.diameter", cfg.Source.Diameter, 0},
+	}
+	for _, n := range numbers {
+		if !finite(n.value) {
+			return fmt.Errorf("%v must be a finite number, got %v", n.name, n.value)
+		}
+		if n.value < n.min {
+			return fmt.Errorf("%v must be at least %v, got %v", n.name, n.min, n.value)
+		}
+	}
+	for _, alt := range []float64{cfg.Target.Altitude, cfg.Park.Altitude, cfg.Stow.Altitude, cfg.Source.Direction.Altitude} {
+		if alt > math.Pi/2 {
+			return fmt.Errorf("altitudes must be at most PI/2(vertical), got %v", alt)
+		}
+	}
+	if cfg.Mirror.Reflectivity > 1 {
+		return fmt.Errorf("mirror.reflectivity must be at most 1, got %v", cfg.Mirror.Reflectivity)
+	}
+	if cfg.Mount.Base.Roll > math.Pi/2 || cfg.Mount.Base.Pitch > math.Pi/2 {
+		return fmt.Errorf("mount.base roll and pitch must be at most PI/2")
+	}
+	if p := cfg.Target.Plane; p != nil && (!finite(p.Azimuth) || !finite(p.Altitude)) {
+		return fmt.Errorf("target.plane must be finite numbers")
+	}
+	if err := validateTarget(cfg.Target); err != nil {
+		return err
+	}
+	if cfg.Mount.AziLimits.Max < cfg.Mount.AziLimits.Min || cfg.Mount.AltLimits.Max < cfg.Mount.AltLimits.Min {
+		return fmt.Errorf("mount limits must have max greater than min")
+	}
+	if cfg.UpdatePeriod.Max > 0 && cfg.UpdatePeriod.Min > cfg.UpdatePeriod.Max {
+		return fmt.Errorf("update_period.min must not be more than update_period.max")
+	}
+	switch cfg.Unreachable {
+	case "", sun.UnreachableBestEffort, sun.UnreachablePark, sun.UnreachableHold:
+	default:
+		return fmt.Errorf("unknown unreachable_policy %q", cfg.Unreachable)
+	}
+	switch cfg.Device {
+	case "", sun.DeviceHeliostat, sun.DeviceTracker:
+	default:
+		return fmt.Errorf("unknown device %q", cfg.Device)
+	}
+	switch cfg.Source.Kind {
+	case "", sun.SourceSun, sun.SourceMoon, sun.SourceFixed:
+	default:
+		return fmt.Errorf("unknown source.kind %q", cfg.Source.Kind)
+	}
+	switch cfg.Ephemeris.Algorithm {
+	case "", sun.EphemerisSunCalc, sun.EphemerisSPA:
+	default:
+		return fmt.Errorf("unknown ephemeris.algorithm %q", cfg.Ephemeris.Algorithm)
+	}
+	for i, r := range cfg.Schedule {
+		err := validateRule(r, cfg.Location)
+		if err != nil {
+			return fmt.Errorf("schedule rule %d (%v): %v", i, r.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateTarget checks a target given as a point is usable
+func validateTarget(t sun.Target) error {
+	switch {
+	case t.Local != nil && t.Geodetic != nil:
+		return fmt.Errorf("target can be an enu offset or a geodetic position, not both")
+	case t.Local != nil:
+		p := t.Local
+		if !finite(p.East) || !finite(p.North) || !finite(p.Up) {
+			return fmt.Errorf("target.enu must be finite numbers")
+		}
+		if p.East == 0 && p.North == 0 && p.Up == 0 {
+			return fmt.Errorf("target.enu can't be the mirror's pivot")
+		}
+	case t.Geodetic != nil:
+		p := t.Geodetic
+		if !finite(p.Lat) || p.Lat < -90 || p.Lat > 90 || !finite(p.Long) || p.Long < -180 || p.Long > 180 || !finite(p.Height) {
+			return fmt.Errorf("target.geodetic needs lat between -90 and 90, long between -180 and 180 and a finite height")
+		}
+	}
+	return nil
+}
+
+func finite(f float64) bool { return !math.IsNaN(f) && !math.IsInf(f, 0) }
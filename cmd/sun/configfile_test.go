@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+func TestMergeConfig(tt *testing.T) {
+	cfg := types.Config{
+		Location: types.Location{Lat: -37, Long: 174},
+		Target:   types.Target{Direction: types.Direction{Altitude: 0.2, Azimuth: 0.1}},
+		Schedule: []types.ScheduleRule{{Name: "a"}, {Name: "b"}},
+	}
+	merged, changed, err := mergeConfig(cfg, []byte(`{"loc":{"lat":-40},"schedule":[{"name":"c"}]}`))
+	if err != nil {
+		tt.Fatalf("Error with TestMergeConfig... unexpected error: %v", err)
+	}
+	if merged.Location.Lat != -40 || merged.Location.Long != 174 || merged.Target != cfg.Target {
+		tt.Errorf("Error with TestMergeConfig... fields not merged, got: %v", merged)
+	}
+	if len(merged.Schedule) != 1 || cfg.Schedule[0].Name != "a" {
+		tt.Errorf("Error with TestMergeConfig... schedule should be replaced without touching the original, got: %v and %v", merged.Schedule, cfg.Schedule)
+	}
+	if expect := []string{"loc.lat", "schedule"}; !reflect.DeepEqual(changed, expect) {
+		tt.Errorf("Error with TestMergeConfig... Got changed: %v expected: %v", changed, expect)
+	}
+	if _, _, err := mergeConfig(cfg, []byte(`{"loc":{"latitude":-40}}`)); err == nil {
+		tt.Errorf("Error with TestMergeConfig... expected unknown field to be rejected")
+	}
+	merged, _, _ = mergeConfig(cfg, []byte(`{"loc":{"lat":-95}}`))
+	if err := validateConfig(merged); err == nil {
+		tt.Errorf("Error with TestMergeConfig... expected latitude out of range to be invalid")
+	}
+}
+
+func TestReadConfigFileDefaults(tt *testing.T) {
+	path := filepath.Join(tt.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"loc":{"lat":-41},"mount":{"azi_steps_per_deg":10}}`), 0644)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		tt.Fatalf("Error with TestReadConfigFileDefaults... unexpected error: %v", err)
+	}
+	if cfg.Location.Lat != -41 || cfg.Mount.AziStepsPerDegree != 10 {
+		tt.Errorf("Error with TestReadConfigFileDefaults... fields in the file not read, got: %v", cfg)
+	}
+	//everything else, including fields inside objects the file does set, keeps the defaults
+	expect := defaultConfig()
+	expect.Location.Lat = -41
+	expect.Mount.AziStepsPerDegree = 10
+	if !reflect.DeepEqual(cfg, expect) {
+		tt.Errorf("Error with TestReadConfigFileDefaults... Got: %+v expected: %+v", cfg, expect)
+	}
+	if err := validateConfig(cfg); err != nil {
+		tt.Errorf("Error with TestReadConfigFileDefaults... partial config should be valid: %v", err)
+	}
+}
+
+// editConfigFile changes the config file as an operator would, the mod time is moved on so the change is always noticed
+func editConfigFile(tt *testing.T, path string, edit func(*types.Config)) {
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	edit(&cfg)
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(path, later, later)
+	if err != nil {
+		tt.Fatal(err)
+	}
+}
+
+func TestConfigFileReload(tt *testing.T) {
+	path := filepath.Join(tt.TempDir(), "config.json")
+	c := NewController(nil, make(chan []byte, 100), nil)
+	err := c.UseConfigFile(path, nil) //no file yet, saves the defaults
+	if err != nil {
+		tt.Fatalf("Error with TestConfigFileReload... unexpected error: %v", err)
+	}
+	saved, err := readConfigFile(path)
+	if err != nil || saved.Location != c.activeConfig.Location {
+		tt.Fatalf("Error with TestConfigFileReload, save... Got: %v, %v expected: %v", saved.Location, err, c.activeConfig.Location)
+	}
+	if c.configFileChanged() {
+		tt.Errorf("Error with TestConfigFileReload... our own save shouldn't count as a change")
+	}
+
+	//an external edit is reloaded
+	editConfigFile(tt, path, func(cfg *types.Config) { cfg.Location.Lat = -41 })
+	if !c.configFileChanged() {
+		tt.Fatalf("Error with TestConfigFileReload... external edit not noticed")
+	}
+	c.reloadConfig()
+	if c.activeConfig.Location.Lat != -41 || c.configFileChanged() {
+		tt.Errorf("Error with TestConfigFileReload, reload... Got: %v expected: %v", c.activeConfig.Location.Lat, -41)
+	}
+
+	//an invalid edit keeps the active config
+	editConfigFile(tt, path, func(cfg *types.Config) { cfg.Location.Lat = -95 })
+	c.reloadConfig()
+	if c.activeConfig.Location.Lat != -41 {
+		tt.Errorf("Error with TestConfigFileReload, invalid edit... Got: %v expected: %v", c.activeConfig.Location.Lat, -41)
+	}
+
+	//the running override time isn't reset by a reload that leaves it alone
+	editConfigFile(tt, path, func(cfg *types.Config) { cfg.Location.Lat = -42 })
+	running := c.activeConfig.OverrideTime.Add(3 * time.Hour)
+	c.activeConfig.OverrideTime = running
+	c.reloadConfig()
+	if c.activeConfig.Location.Lat != -42 || !c.activeConfig.OverrideTime.Equal(running) {
+		tt.Errorf("Error with TestConfigFileReload, override time... Got: %v expected: %v", c.activeConfig.OverrideTime, running)
+	}
+}
+
+func TestMergeConfigReplacesLists(tt *testing.T) {
+	cfg := types.Config{
+		Schedule:    []types.ScheduleRule{{Name: "a", Weekdays: []string{"mon"}, Start: types.TimeOfDay{Clock: "08:00"}, Mode: types.ModePark}},
+		Corrections: types.Corrections{Learn: true, Points: []types.CorrectionPoint{{Azimuth: 0.1, Nudges: 3}}},
+	}
+	merged, _, err := mergeConfig(cfg, []byte(`{"schedule":[{"name":"b","start":{"event":"sunrise"},"end":{"clock":"11:00"},"mode":"target"}],"corrections":{"points":[{"alt":0.2}]}}`))
+	if err != nil {
+		tt.Fatalf("Error with TestMergeConfigReplacesLists... unexpected error: %v", err)
+	}
+	expect := types.ScheduleRule{Name: "b", Start: types.TimeOfDay{Event: "sunrise"}, End: types.TimeOfDay{Clock: "11:00"}, Mode: types.ModeTarget}
+	if len(merged.Schedule) != 1 || !reflect.DeepEqual(merged.Schedule[0], expect) {
+		tt.Errorf("Error with TestMergeConfigReplacesLists, schedule... Got: %+v expected: %+v", merged.Schedule, expect)
+	}
+	if len(merged.Corrections.Points) != 1 || merged.Corrections.Points[0] != (types.CorrectionPoint{Altitude: 0.2}) || !merged.Corrections.Learn {
+		tt.Errorf("Error with TestMergeConfigReplacesLists, corrections... Got: %+v", merged.Corrections)
+	}
+	if cfg.Schedule[0].Name != "a" || cfg.Corrections.Points[0].Nudges != 3 {
+		tt.Errorf("Error with TestMergeConfigReplacesLists... the original config was modified, got: %+v", cfg)
+	}
+}
+
+func TestMergeConfigTargetForm(tt *testing.T) {
+	cfg := types.Config{Target: types.Target{Local: &types.ENU{East: 3}}}
+	merged, _, err := mergeConfig(cfg, []byte(`{"target":{"azi":0.5,"alt":0.1}}`))
+	if err != nil || merged.Target.Local != nil || merged.Target.Azimuth != 0.5 {
+		tt.Errorf("Error with TestMergeConfigTargetForm, direction... Got: %+v, %v expected: the enu target replaced", merged.Target, err)
+	}
+	merged, _, err = mergeConfig(cfg, []byte(`{"target":{"geodetic":{"lat":-37,"long":174}}}`))
+	if err != nil || merged.Target.Local != nil || merged.Target.Geodetic == nil || validateTarget(merged.Target) != nil {
+		tt.Errorf("Error with TestMergeConfigTargetForm, geodetic... Got: %+v, %v expected: the enu target replaced", merged.Target, err)
+	}
+	merged, _, _ = mergeConfig(cfg, []byte(`{"target":{"enu":{"n":2}}}`))
+	if merged.Target.Local == nil || *merged.Target.Local != (types.ENU{East: 3, North: 2}) {
+		tt.Errorf("Error with TestMergeConfigTargetForm, enu... Got: %+v expected: the enu target merged", merged.Target.Local)
+	}
+}
+
+func TestSaveConfigMode(tt *testing.T) {
+	path := filepath.Join(tt.TempDir(), "config.json")
+	c := NewController(nil, make(chan []byte, 100), nil)
+	c.configPath = path
+	checkMode := func(expect os.FileMode) {
+		if err := c.saveConfig(); err != nil {
+			tt.Fatalf("Error with TestSaveConfigMode... unexpected error: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if info.Mode().Perm() != expect {
+			tt.Errorf("Error with TestSaveConfigMode... Got: %v expected: %v", info.Mode().Perm(), expect)
+		}
+	}
+	checkMode(0644) //a new file
+	if err := os.Chmod(path, 0640); err != nil {
+		tt.Fatal(err)
+	}
+	checkMode(0640) //the operator restricted it
+}
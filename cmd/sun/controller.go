@@ -2,15 +2,15 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"math"
+	"os"
 	"strings"
 	"time"
 
 	sun "github.com/mykldog7/heliostat2/pkg/types"
-
-	"github.com/sixdouglas/suncalc"
 )
 
 type Controller struct {
@@ -22,39 +22,85 @@ type Controller struct {
 	lastUpdate        time.Time // When was the lastUpdate completed
 	usingOverrideTime bool      // which time are we using for calculations
 	grbl              *GrblArduino
+	activeRule        int               // index of the schedule rule currently applied, -1 for none
+	opMode            sun.OperatingMode // current state of the controller's state machine
+	modeStatus        sun.ModeStatus    // details of the last mode change
+	commanded         axes              // last axes position sent to grbl
+	haveCommanded     bool              // false until we know where the axes were sent, e.g. before homing
+	latency           latencyEstimator  // how long moves take to complete
+	period            time.Duration     // chosen wait until the next update
+	rate              float64           // angular rate of the mirror, used to choose the period
+	reachability      sun.Reachability  // can the mirror reach the position it needs to be in
+	desired           sun.Direction     // where the mirror's normal needs to be, as of the last update
+	started           time.Time
+	configPath        string           // file the config is persisted to, empty if it isn't
+	configModTime     time.Time        // modification time of the config file when last read/written
+	fileConfig        sun.Config       // config as last read/written
+	reload            <-chan os.Signal // signals the config file should be reloaded
+	slew              *targetSlew      // gradual move of the target in progress, nil if none
+	sunEvents         sun.SunEvents    // last published sun events
+	optics            sun.Optics       // optical performance, as of the last update
+	updateDue         bool             // the mode, target or config changed, update now rather than at the end of the period
 }
 
-func NewController(inChan <-chan sun.Message, outChan chan<- []byte, grbl *GrblArduino) Controller {
-	defaultPeriod, _ := time.ParseDuration("5s")
+// defaultConfig is used until a config file is loaded, fields a config file leaves out keep these values
+func defaultConfig() sun.Config {
 	defaultLat, defaultLong := -37.0112, 174.7857
 	initialTime := time.Date(2023, 1, 1, 8, 00, 0, 0, time.Local)
+	return sun.Config{
+		Location:        sun.Location{Lat: defaultLat, Long: defaultLong},
+		OverrideTime:    initialTime,
+		AziOffset:       -math.Pi / 2, //90 degrees offset(eastwards)
+		TimeProgression: 60.0 * 2,
+		Target:          sun.Target{Direction: sun.Direction{Altitude: math.Pi / 18, Azimuth: 0.0}},
+		Park:            sun.Direction{Altitude: 0.0, Azimuth: -math.Pi / 2},         //the zero position
+		Stow:            sun.Direction{Altitude: math.Pi / 2, Azimuth: -math.Pi / 2}, //face up, mirror flat
+		Mount: sun.Mount{
+			DeadBand:  degToRad(0.05), //the reflected beam moves twice as far as the mirror normal
+			AziLimits: sun.Limits{Min: -math.Pi, Max: math.Pi},
+			AltLimits: sun.Limits{Min: 0.0, Max: math.Pi / 2},
+		},
+		Latency:      sun.Latency{Fixed: 500 * time.Millisecond},
+		UpdatePeriod: sun.UpdatePeriod{Min: time.Second, Max: time.Minute, MaxError: degToRad(0.05)},
+		Unreachable:  sun.UnreachableBestEffort,
+		Ephemeris:    sun.Ephemeris{Algorithm: sun.EphemerisSunCalc, Pressure: 1010, Temperature: 10},
+		Source:       sun.Source{Kind: sun.SourceSun},
+		Device:       sun.DeviceHeliostat,
+		Mirror:       sun.Mirror{Width: 1, Height: 1, Reflectivity: 0.9},
+	}
+}
+
+func NewController(inChan <-chan sun.Message, outChan chan<- []byte, grbl *GrblArduino) Controller {
+	defaultPeriod, _ := time.ParseDuration("5s")
 	return Controller{
-		activeConfig: sun.Config{
-			Location:        sun.Location{Lat: defaultLat, Long: defaultLong},
-			OverrideTime:    initialTime,
-			AziOffset:       -math.Pi / 2, //90 degrees offset(eastwards)
-			TimeProgression: 60.0 * 2,
-			Target: struct {
-				Altitude float64 "json:\"alt\""
-				Azimuth  float64 "json:\"azi\""
-			}{Altitude: math.Pi / 18, Azimuth: 0.0}},
+		activeConfig:      defaultConfig(),
 		in:                inChan,
 		publish:           outChan,
 		updatePeriod:      defaultPeriod,
+		period:            defaultPeriod,
 		localTime:         time.Now(),
 		lastUpdate:        time.Now(),
 		usingOverrideTime: true, //TODO back to false
 		grbl:              grbl,
+		activeRule:        -1,
+		opMode:            sun.Initialising,
+		modeStatus:        sun.ModeStatus{Mode: sun.Initialising, Since: time.Now()},
+		reachability:      sun.Reachability{Reachable: true},
+		started:           time.Now(),
 	}
 }
 
 func (c Controller) Start(ctx context.Context) error {
-	ticker := time.NewTicker(c.updatePeriod) //this triggers an update to be sent via GCode //update frequency for the robot
+	timer := time.NewTimer(c.period) //this triggers an update to be sent via GCode, it's reset to the chosen period after each update
+	//on failure we're left faulted, a client can retry homing
+	c.requestMode(sun.Homing, "startup")
+	configCheck := time.NewTicker(time.Second) //watch for changes to the config file
 	for {
 		select {
 
 		case <-ctx.Done():
 			//disable steppers, shutdown active commands, we're going down...
+			c.setMode(sun.Stopped, "shutdown")
 			log.Printf("Terminating control loop, see ya.")
 			return nil
 
@@ -65,9 +111,7 @@ func (c Controller) Start(ctx context.Context) error {
 			switch msg.T {
 
 			case "UpdateConfig":
-				uc := sun.Config{}
-				json.Unmarshal(msg.D, &uc)
-				c.HandleConfigUpdate(uc)
+				c.HandleConfigUpdate(msg)
 
 			case "GetConfig":
 				c.HandleGetActiveConfig()
@@ -75,11 +119,87 @@ func (c Controller) Start(ctx context.Context) error {
 			case "MoveTargetRelative":
 				c.HandleTargetAdjustment(msg)
 
+			case "SetTarget":
+				c.HandleSetTarget(msg)
+
+			case "GetActiveRule":
+				c.HandleGetActiveRule()
+
+			case "RequestMode":
+				c.HandleModeRequest(msg)
+
+			case "GetMode":
+				c.HandleGetMode()
+
+			case "GetLatency":
+				c.HandleGetLatency()
+
+			case "GetUpdatePeriod":
+				c.HandleGetUpdatePeriod()
+
+			case "GetReachability":
+				c.HandleGetReachability()
+
+			case "JogAxes":
+				c.HandleJog(msg)
+
+			case "RecordObservation":
+				c.HandleRecordObservation()
+
+			case "FitCalibration":
+				c.HandleFitCalibration()
+
+			case "ClearCalibration":
+				c.HandleClearCalibration()
+
+			case "GetCalibration":
+				c.HandleGetCalibration()
+
+			case "GetCorrections":
+				c.HandleGetCorrections()
+
+			case "ClearCorrections":
+				c.HandleClearCorrections()
+
+			case "ExportCorrections":
+				c.HandleExportCorrections()
+
+			case "Inclinometer":
+				c.HandleInclinometer(msg)
+
+			case "GetSunEvents":
+				c.HandleGetSunEvents()
+
+			case "GetOptics":
+				c.HandleGetOptics()
+
+			case "GetSpot":
+				c.HandleGetSpot(msg)
+
+			case "GetState":
+				//the state is published after every command
+
 			default:
 				log.Printf("Controller dropped message with type %v as no handler defined.", msg.T)
 			}
+			c.checkSunEvents() //the location may have changed
+			c.publishState()
+
+		case d := <-c.grbl.MoveTimes():
+			if c.activeConfig.Latency.Learn {
+				c.latency.add(d)
+				log.Printf("Move took %v, latency estimate %v", d, c.latency.estimate)
+			}
+
+		case <-c.reload:
+			c.reloadConfig()
+
+		case <-configCheck.C:
+			if c.configFileChanged() {
+				c.reloadConfig()
+			}
 
-		case <-ticker.C:
+		case <-timer.C:
 			//updates controller times
 			c.localTime = time.Now()
 			gap := time.Since(c.lastUpdate)
@@ -87,37 +207,198 @@ func (c Controller) Start(ctx context.Context) error {
 			c.activeConfig.OverrideTime = c.activeConfig.OverrideTime.Add(gap)
 			c.lastUpdate = time.Now()
 
-			//recalculate desired position
-			mAzi, mAlt := c.RecalculateDesiredMirrorPosition()
-			mAzi_Deg := radToDeg(mAzi)
-			mAlt_Deg := radToDeg(mAlt)
+			c.checkSunEvents()
+			c.update()
+			c.updateOptics()
+			c.updateDue = false
+			c.period = c.nextUpdatePeriod()
+			log.Printf("Next update in %v", c.period)
+			timer.Reset(c.period)
+			c.publishState()
+		}
+		if c.updateDue {
+			timer.Reset(0) //e.g. stowing for high wind shouldn't wait for the rest of a long period
+		}
+	}
+}
 
-			//convert position to GCode..
-			code, err := PositionToGCode(mAzi_Deg, mAlt_Deg, radToDeg(c.activeConfig.AziOffset), radToDeg(c.activeConfig.AltOffset))
-			if err != nil {
-				log.Printf("%v", err)
-			}
-			resp, err := c.grbl.GrblSendCommandGetResponse(code)
-			if err != nil {
-				log.Printf("Error from GRBL: %v", err)
-				return err
-			}
-			log.Printf("Sent %v to grbl for moment %v ... got response \"%v\"", strings.TrimSuffix(string(code), "\n"), c.cTime(), string(resp[0:2]))
-			//c.publish <- []byte(fmt.Sprintf("Sent %v to grbl at: %v", string(code), tick)) //this will generally cause problems for the clients, if they are expecting something else
+// update applies the schedule and, depending on the mode, moves the mirror to track the target or to the park/stow position
+func (c *Controller) update() {
+	c.applySchedule()
+	c.slewTarget()
+
+	var mAzi, mAlt float64
+	switch c.opMode {
+	case sun.Tracking:
+		//recalculate desired position, for when the move will have completed
+		mAzi, mAlt = c.RecalculateDesiredMirrorPosition(c.cTime().Add(c.lookAhead()))
+	case sun.Parked:
+		mAzi, mAlt = c.activeConfig.Park.Azimuth, c.activeConfig.Park.Altitude
+	case sun.Stowed:
+		mAzi, mAlt = c.activeConfig.Stow.Azimuth, c.activeConfig.Stow.Altitude
+	default:
+		log.Printf("Mode is %v, mirror not moved", c.opMode)
+		return
+	}
+	c.desired = sun.Direction{Azimuth: mAzi, Altitude: mAlt}
+
+	//convert position to axes, only whole motor steps can be reached
+	mount := c.activeConfig.Mount
+	lim := mountLimits(mount)
+	target, err := c.directionAxes(c.desired)
+	var limit LimitError
+	if errors.As(err, &limit) {
+		var move bool
+		target, move = c.handleUnreachable(mAzi, mAlt, target, limit)
+		if !move {
+			return
+		}
+	} else if err != nil {
+		log.Printf("%v", err)
+		return
+	} else {
+		c.setReachability(sun.Reachability{Reachable: true})
+	}
+	target = target.quantise(mount.AziStepsPerDegree, mount.AltStepsPerDegree)
+	target, _ = lim.clip(target) //rounding to a whole step can take us just past a limit
+	if c.haveCommanded && target.within(c.commanded, radToDeg(mount.DeadBand)) {
+		log.Printf("Move to %.4f, %.4f is within the dead-band, skipped", target.Azi, target.Alt)
+		return
+	}
+	c.moveTo(target)
+}
+
+// moveTo sends the axes to the target position, and announces the move
+// a failure to move the mirror faults the controller
+func (c *Controller) moveTo(target axes) error {
+	//convert position to GCode..
+	code := target.GCode()
+	sent := time.Now()
+	resp, err := c.grbl.GrblSendCommandGetResponse(code)
+	if err != nil {
+		c.haveCommanded = false
+		err = fmt.Errorf("error from GRBL: %v", err)
+		c.fault(err)
+		return err
+	}
+	c.commanded, c.haveCommanded = target, true
+	duration := time.Since(sent)
+	if c.activeConfig.Latency.Learn {
+		c.grbl.TimeMove(sent) //measured in the background, see MoveTimes
+	}
+	log.Printf("Sent %v to grbl for moment %v ... got response \"%v\"", strings.TrimSuffix(string(code), "\n"), c.cTime(), string(resp[0:2]))
+	pos := c.axesDirection(target)
+	c.publish <- sun.NewMessage("Reposition", sun.Reposition{
+		Time:      c.cTime(),
+		Azimuth:   pos.Azimuth,
+		Elevation: pos.Altitude,
+		GCode:     strings.TrimSpace(string(code)),
+		Response:  strings.TrimSpace(string(resp)),
+		Duration:  duration,
+	})
+	return nil
+}
+
+// axesDirection returns the direction(radians, horizontal frame) of the mirror's normal at the axes position
+func (c *Controller) axesDirection(a axes) sun.Direction {
+	d := axesToDirection(a, c.activeConfig.AziOffset, c.activeConfig.AltOffset)
+	//undo the pointing model's correction, it's small so a few iterations is plenty
+	for i := 0; i < 3 && c.activeConfig.Calibration.Enabled; i++ {
+		dAzi, dAlt := c.pointingCorrection(d.Azimuth, d.Altitude)
+		d = axesToDirection(a, c.activeConfig.AziOffset-dAzi, c.activeConfig.AltOffset-dAlt)
+	}
+	return fromMountFrame(d, c.activeConfig.Mount.Base)
+}
+
+// directionAxes returns the axes position that points the mirror's normal in direction d
+// the axes move relative to the mount's base, which may not be level, and the pointing model corrects for the
+// mount's misalignment on top of the offsets
+func (c *Controller) directionAxes(d sun.Direction) (axes, error) {
+	mount := c.activeConfig.Mount
+	m := toMountFrame(d, mount.Base)
+	dAzi, dAlt := c.pointingCorrection(m.Azimuth, m.Altitude)
+	aziOffset := radToDeg(c.activeConfig.AziOffset - dAzi)
+	altOffset := radToDeg(c.activeConfig.AltOffset - dAlt)
+	return PositionToAxes(radToDeg(m.Azimuth), radToDeg(m.Altitude), aziOffset, altOffset, mountLimits(mount), c.positionNear(), mount.AllowFlip)
+}
+
+// applySchedule finds the schedule rule for the current time, when it changes the new rule is applied and announced
+func (c *Controller) applySchedule() {
+	i := activeRule(c.activeConfig.Schedule, c.cTime(), c.activeConfig.Location)
+	if i == c.activeRule {
+		return
+	}
+	c.activeRule = i
+	info := c.activeRuleInfo()
+	if i >= 0 {
+		r := c.activeConfig.Schedule[i]
+		log.Printf("Schedule rule %d (%v) now active, mode: %v", i, r.Name, r.Mode)
+		if r.Mode == sun.ModeTarget && r.Target != nil {
+			c.activeConfig.Target = *r.Target
+			c.slew = nil
 		}
+	} else {
+		log.Printf("No schedule rule active")
+	}
+	c.publish <- sun.NewMessage("ActiveRule", info)
+	//without a rule we go back to tracking
+	err := c.requestMode(scheduleModes[info.Mode], fmt.Sprintf("schedule rule %d (%v)", info.Index, info.Name))
+	if err != nil {
+		log.Printf("Schedule could not change mode: %v", err)
+	}
+}
+
+// activeRuleInfo describes the active schedule rule for clients
+func (c *Controller) activeRuleInfo() sun.ActiveRule {
+	if c.activeRule < 0 || c.activeRule >= len(c.activeConfig.Schedule) {
+		return sun.ActiveRule{Index: -1, Mode: sun.ModeTarget}
 	}
+	r := c.activeConfig.Schedule[c.activeRule]
+	return sun.ActiveRule{Index: c.activeRule, Name: r.Name, Mode: r.Mode}
 }
 
-// RecalculateTarget returns the position correct according to configured time
+// RecalculateTarget returns the position correct at time t
 // Altitude: sun altitude above the horizon in radians, e.g. -1 at the horizon and PI/2 at the zenith (straight over your head)
 // Azimuth: sun azimuth in radians (direction along the horizon, measured from south to west), e.g. -1 is south and Math.PI * 3/4 is northwest
-func (c *Controller) RecalculateDesiredMirrorPosition() (float64, float64) {
-	log.Printf("Target (azi, alt): %.3f, %.3f", radToDeg(c.activeConfig.Target.Azimuth), radToDeg(c.activeConfig.Target.Altitude))
-	sun := suncalc.GetPosition(c.cTime(), c.activeConfig.Location.Lat, c.activeConfig.Location.Long)
-	log.Printf("Sun (azi, alt): %.3f, %.3f", radToDeg(sun.Azimuth), radToDeg(sun.Altitude))
-	mirrorAzi, mirrorAlt := calculateMirrorTarget(sun.Azimuth, sun.Altitude, c.activeConfig.Target.Azimuth, c.activeConfig.Target.Altitude)
-	log.Printf("Mirror (azi, alt): %.3f, %.3f", radToDeg(mirrorAzi), radToDeg(mirrorAlt))
-	return mirrorAzi, mirrorAlt
+func (c *Controller) RecalculateDesiredMirrorPosition(t time.Time) (float64, float64) {
+	g := c.desiredGeometry(t)
+	if c.directTracker() {
+		log.Printf("Tracking %v (azi, alt): %.3f, %.3f", c.sourceKind(), radToDeg(g.source.Azimuth), radToDeg(g.source.Altitude))
+	} else {
+		log.Printf("Target (azi, alt): %.3f, %.3f", radToDeg(g.target.Azimuth), radToDeg(g.target.Altitude))
+		log.Printf("Source %v (azi, alt): %.3f, %.3f", c.sourceKind(), radToDeg(g.source.Azimuth), radToDeg(g.source.Altitude))
+		log.Printf("Mirror (azi, alt): %.3f, %.3f", radToDeg(g.normal.Azimuth), radToDeg(g.normal.Altitude))
+	}
+	return g.normal.Azimuth, g.normal.Altitude
+}
+
+// geometry is where the source, target and mirror normal are at a moment
+type geometry struct {
+	source sun.Direction
+	target sun.Direction // with any learned correction applied
+	dist   float64       // to the target, 0 if it's far away
+	normal sun.Direction
+}
+
+// desiredGeometry returns where the mirror's normal should be at time t, without changing anything on the controller
+// a tracker points straight at the source
+func (c *Controller) desiredGeometry(t time.Time) geometry {
+	g := geometry{}
+	g.source.Azimuth, g.source.Altitude = c.sourcePosition(t)
+	if c.directTracker() {
+		g.target, g.normal = g.source, g.source
+		return g
+	}
+	g.target, g.dist = c.targetDirection()
+	g.target = c.correctTarget(g.target, g.source)
+	g.normal.Azimuth, g.normal.Altitude = calculateMirrorTargetNear(g.source.Azimuth, g.source.Altitude, g.target.Azimuth, g.target.Altitude, g.dist, c.activeConfig.Mount.MirrorOffset)
+	return g
+}
+
+// sunPosition returns the sun's azimuth and altitude at time t, for the configured location
+func (c *Controller) sunPosition(t time.Time) (float64, float64) {
+	pos := newEphemeris(c.activeConfig.Ephemeris).SunPosition(t, c.activeConfig.Location)
+	return pos.Azimuth, pos.Altitude
 }
 
 // returns the 'current-active' time
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+const (
+	defaultCorrectionRadius = math.Pi / 18  // 10 degrees
+	correctionMergeDistance = math.Pi / 180 // nudges within a degree of a point update it, rather than adding another
+)
+
+// interpolateCorrection returns the correction(radians) for the sun at s, inverse distance weighted from the points within radius.
+// The correction fades out towards the edge of the radius, so it's 0 where nothing has been learned
+func interpolateCorrection(points []sun.CorrectionPoint, s sun.Direction, radius float64) (float64, float64) {
+	if radius <= 0 {
+		radius = defaultCorrectionRadius
+	}
+	var sumW, sumAzi, sumAlt float64
+	nearest := radius
+	for _, p := range points {
+		d := angleBetween(s.Azimuth, s.Altitude, p.Sun.Azimuth, p.Sun.Altitude)
+		if d >= radius {
+			continue
+		}
+		if d < 1e-9 {
+			return p.Azimuth, p.Altitude //exactly on a point
+		}
+		w := 1 / (d * d)
+		sumW += w
+		sumAzi += w * p.Azimuth
+		sumAlt += w * p.Altitude
+		nearest = math.Min(nearest, d)
+	}
+	if sumW == 0 {
+		return 0, 0
+	}
+	fade := 1 - math.Pow(nearest/radius, 2)
+	return fade * sumAzi / sumW, fade * sumAlt / sumW
+}
+
+// correctTarget adds the learned correction for the sun's position to the target direction
+func (c *Controller) correctTarget(target sun.Direction, s sun.Direction) sun.Direction {
+	cor := c.activeConfig.Corrections
+	if !cor.Learn || len(cor.Points) == 0 {
+		return target
+	}
+	dAzi, dAlt := interpolateCorrection(cor.Points, s, cor.Radius)
+	if dAzi == 0 && dAlt == 0 {
+		return target
+	}
+	log.Printf("Learned correction (azi, alt): %.3f, %.3f", radToDeg(dAzi), radToDeg(dAlt))
+	target.Azimuth = math.Remainder(target.Azimuth+dAzi, 2*math.Pi)
+	target.Altitude = math.Max(-math.Pi/2, math.Min(math.Pi/2, target.Altitude+dAlt))
+	return target
+}
+
+// learnNudge records a nudge as a correction at the sun's current position, instead of moving the target.
+// The point holds the total correction there, so the nudge takes effect straight away and on later days
+func (c *Controller) learnNudge(mtr sun.MoveTargetRelative) {
+	var dAzi, dAlt float64
+	switch mtr.Direction {
+	case "up":
+		dAlt = mtr.Amount
+	case "down":
+		dAlt = -mtr.Amount
+	case "left":
+		dAzi = -mtr.Amount
+	case "right":
+		dAzi = mtr.Amount
+	default:
+		c.publish <- sun.NewAckMessage(false)
+		return
+	}
+	t := c.cTime()
+	sAzi, sAlt := c.sourcePosition(t)
+	s := sun.Direction{Azimuth: sAzi, Altitude: sAlt}
+	cor := &c.activeConfig.Corrections
+	azi, alt := interpolateCorrection(cor.Points, s, cor.Radius)
+	p := sun.CorrectionPoint{Sun: s, Azimuth: azi + dAzi, Altitude: alt + dAlt, Nudges: 1, Updated: t}
+	merged := false
+	for i, q := range cor.Points {
+		if angleBetween(sAzi, sAlt, q.Sun.Azimuth, q.Sun.Altitude) < correctionMergeDistance {
+			p.Nudges += q.Nudges
+			cor.Points[i] = p
+			merged = true
+			break
+		}
+	}
+	if !merged {
+		cor.Points = append(cor.Points, p)
+	}
+	log.Printf("Learned correction (azi, alt) %.3f, %.3f with the sun at %.3f, %.3f", radToDeg(p.Azimuth), radToDeg(p.Altitude), radToDeg(sAzi), radToDeg(sAlt))
+	c.slew = nil //a nudge replaces any slew in progress
+	c.persistConfig()
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// correctionsCSV formats the correction points as csv, angles in degrees
+func correctionsCSV(points []sun.CorrectionPoint) string {
+	var b strings.Builder
+	b.WriteString("sun_azi,sun_alt,azi,alt,nudges,updated\n")
+	for _, p := range points {
+		fmt.Fprintf(&b, "%.4f,%.4f,%.4f,%.4f,%d,%v\n", radToDeg(p.Sun.Azimuth), radToDeg(p.Sun.Altitude),
+			radToDeg(p.Azimuth), radToDeg(p.Altitude), p.Nudges, p.Updated.Format(time.RFC3339))
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+type correctionCase struct {
+	s      types.Direction
+	expect float64 // altitude correction
+	tol    float64
+}
+
+var correctionPoints = []types.CorrectionPoint{
+	{Sun: types.Direction{Azimuth: 0, Altitude: 0.5}, Altitude: 0.01},
+	{Sun: types.Direction{Azimuth: 0.1, Altitude: 0.5}, Altitude: 0.03},
+}
+
+var correctionCases = []correctionCase{
+	{types.Direction{Azimuth: 0, Altitude: 0.5}, 0.01, 1e-9},        //on a point
+	{types.Direction{Azimuth: 0.1, Altitude: 0.5}, 0.03, 1e-9},      //on the other point
+	{types.Direction{Azimuth: 1.5, Altitude: 0.5}, 0, 1e-9},         //nothing learned near here
+	{types.Direction{Azimuth: 0.05, Altitude: 0.5}, 0.0187, 0.0005}, //half way, faded a little
+}
+
+func TestInterpolateCorrection(tt *testing.T) {
+	for i, tc := range correctionCases {
+		_, got := interpolateCorrection(correctionPoints, tc.s, 0)
+		if math.Abs(got-tc.expect) > tc.tol {
+			tt.Errorf("Error with TestInterpolateCorrection case %d... Got: %v expected: %v", i, got, tc.expect)
+		}
+	}
+}
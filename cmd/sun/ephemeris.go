@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+	"github.com/sixdouglas/suncalc"
+)
+
+// ephemeris calculates where the sun is
+type ephemeris interface {
+	// SunPosition returns the sun's direction(radians, azimuth from south towards west) at time t, seen from loc
+	SunPosition(t time.Time, loc sun.Location) sun.Direction
+}
+
+// newEphemeris returns the algorithm selected in the config, suncalc if none is
+func newEphemeris(cfg sun.Ephemeris) ephemeris {
+	if cfg.Algorithm == sun.EphemerisSPA {
+		return spaEphemeris{cfg}
+	}
+	return suncalcEphemeris{}
+}
+
+// suncalcEphemeris is quick, but only accurate to about a tenth of a degree and ignores refraction
+type suncalcEphemeris struct{}
+
+func (suncalcEphemeris) SunPosition(t time.Time, loc sun.Location) sun.Direction {
+	pos := suncalc.GetPosition(t, loc.Lat, loc.Long)
+	return sun.Direction{Azimuth: pos.Azimuth, Altitude: pos.Altitude}
+}
+
+// spaEphemeris is NREL's Solar Position Algorithm, see spa.go
+type spaEphemeris struct {
+	cfg sun.Ephemeris
+}
+
+func (e spaEphemeris) SunPosition(t time.Time, loc sun.Location) sun.Direction {
+	deltaT := e.cfg.DeltaT
+	if deltaT == 0 {
+		deltaT = estimateDeltaT(t)
+	}
+	res := spaPosition(t, deltaT, loc.Lat, loc.Long, loc.Height, e.cfg.Pressure, e.cfg.Temperature)
+	return sun.Direction{Azimuth: math.Remainder(degToRad(res.azimuth), 2*math.Pi), Altitude: degToRad(90 - res.zenith)}
+}
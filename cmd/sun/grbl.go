@@ -18,6 +18,9 @@ type GrblArduino struct {
 	port     serial.Port
 	portName string
 	mutex    sync.Mutex
+	status   []byte             //last status report, guarded by mutex
+	moveSent time.Time          //when the move being timed was sent, zero if none is, guarded by mutex
+	moveDone chan time.Duration //how long timed moves took to complete
 }
 
 func NewGrblArduino(ctx context.Context) (*GrblArduino, error) {
@@ -25,7 +28,7 @@ func NewGrblArduino(ctx context.Context) (*GrblArduino, error) {
 		BaudRate: 115200, //adjust baud here, or other serial connection settings
 	}
 
-	grbl := GrblArduino{}
+	grbl := GrblArduino{moveDone: make(chan time.Duration, 1)}
 
 	//Connect to each port scanning for the one that is the grbl arduino
 	err := grbl.Connect(mode)
@@ -34,18 +37,12 @@ func NewGrblArduino(ctx context.Context) (*GrblArduino, error) {
 	}
 	log.Printf("Connected to Grbl on %v\n", grbl.portName)
 
-	//Zero the machine, hopefully its correctly positioned, if not ... turn it off, re-position and restart
-	_, err = grbl.GrblSendCommandGetResponse([]byte("G92 X0 Y0 Z0\n"))
-	if err != nil {
-		return nil, err
-	}
-	log.Printf("Set current machine position to 0 azimuth, 0 altitude.")
-
 	//Control loop, manages grbl status pings.
 	go func() {
 		log.Printf("Grbl control loop started...")
 		grblPingFreq, _ := time.ParseDuration(("1000ms"))
 		statusPing := time.NewTicker(grblPingFreq)
+		movePoll := time.NewTicker(50 * time.Millisecond)
 		for {
 			select {
 			case <-ctx.Done():
@@ -57,6 +54,9 @@ func NewGrblArduino(ctx context.Context) (*GrblArduino, error) {
 				grbl.GetStatus()
 				//stat, _ := grbl.GetStatus()
 				//log.Printf("stat:%v", string(stat))
+
+			case <-movePoll.C:
+				grbl.checkMoveDone()
 			}
 		}
 	}()
@@ -187,5 +187,73 @@ func (g *GrblArduino) GetStatus() ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
+	g.status = line
 	return line, nil
 }
+
+// LastStatus returns the most recent status report from grbl, without asking for a new one
+func (g *GrblArduino) LastStatus() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return strings.TrimSpace(string(g.status))
+}
+
+// Connected reports if a serial connection to grbl is open
+func (g *GrblArduino) Connected() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.port != nil
+}
+
+// TimeMove starts timing the move sent at sent, its duration is reported on MoveTimes once grbl is Idle again
+func (g *GrblArduino) TimeMove(sent time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.moveSent = sent
+}
+
+// MoveTimes reports how long timed moves took to complete
+func (g *GrblArduino) MoveTimes() <-chan time.Duration {
+	return g.moveDone
+}
+
+// checkMoveDone polls the status while a move is being timed, reporting the duration when it completes
+func (g *GrblArduino) checkMoveDone() {
+	g.mutex.Lock()
+	sent := g.moveSent
+	g.mutex.Unlock()
+	if sent.IsZero() {
+		return
+	}
+	stat, err := g.GetStatus()
+	if err != nil || !bytes.HasPrefix(stat, []byte("<Idle")) {
+		return
+	}
+	g.mutex.Lock()
+	if !g.moveSent.Equal(sent) {
+		g.mutex.Unlock()
+		return //another move was sent meanwhile, time that one instead
+	}
+	g.moveSent = time.Time{}
+	g.mutex.Unlock()
+	select {
+	case g.moveDone <- time.Since(sent):
+	default: //the last one hasn't been collected, drop this one
+	}
+}
+
+// WaitForIdle polls grbl's status until it reports Idle, i.e. all moves have completed
+func (g *GrblArduino) WaitForIdle(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		stat, err := g.GetStatus()
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(stat, []byte("<Idle")) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("grbl not idle after %v", timeout)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// latencyEstimator keeps a running estimate of how long a move takes to complete, from measured moves
+type latencyEstimator struct {
+	estimate time.Duration
+	last     time.Duration
+	samples  int
+}
+
+// add includes a measured move duration in the estimate, recent moves count the most
+func (l *latencyEstimator) add(d time.Duration) {
+	l.last = d
+	l.samples++
+	if l.samples == 1 {
+		l.estimate = d
+		return
+	}
+	l.estimate += (d - l.estimate) / 5
+}
+
+// lookAhead returns how far past the update time the mirror position should be calculated for,
+// while simulating time this is scaled by the time progression
+func (c *Controller) lookAhead() time.Duration {
+	cfg := c.activeConfig.Latency
+	latency := cfg.Fixed
+	if cfg.Learn && c.latency.samples > 0 {
+		latency = c.latency.estimate
+	}
+	latency += cfg.Settle
+	if c.usingOverrideTime {
+		latency = time.Duration(float64(latency) * c.activeConfig.TimeProgression)
+	}
+	return latency
+}
+
+// latencyStatus describes the current latency estimate for clients
+func (c *Controller) latencyStatus() sun.LatencyStatus {
+	return sun.LatencyStatus{
+		LookAhead: c.lookAhead(),
+		Estimate:  c.latency.estimate,
+		LastMove:  c.latency.last,
+		Samples:   c.latency.samples,
+		Learning:  c.activeConfig.Latency.Learn,
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+func TestLatencyEstimator(tt *testing.T) {
+	l := latencyEstimator{}
+	l.add(time.Second)
+	if l.estimate != time.Second || l.samples != 1 {
+		tt.Errorf("Error with TestLatencyEstimator, first sample... Got: %v expected: %v", l.estimate, time.Second)
+	}
+	l.add(2 * time.Second) //moves a fifth of the way towards each new sample
+	if l.estimate != 1200*time.Millisecond || l.last != 2*time.Second || l.samples != 2 {
+		tt.Errorf("Error with TestLatencyEstimator, second sample... Got: %v expected: %v", l.estimate, 1200*time.Millisecond)
+	}
+}
+
+func TestLookAhead(tt *testing.T) {
+	tests := []struct {
+		name     string
+		latency  types.Latency
+		learned  bool
+		override bool
+		expected time.Duration
+	}{
+		{"fixed", types.Latency{Fixed: 500 * time.Millisecond, Settle: 100 * time.Millisecond}, true, false, 600 * time.Millisecond},
+		{"learning no samples", types.Latency{Fixed: 500 * time.Millisecond, Learn: true}, false, false, 500 * time.Millisecond},
+		{"learning", types.Latency{Fixed: 500 * time.Millisecond, Learn: true, Settle: 100 * time.Millisecond}, true, false, 300 * time.Millisecond},
+		{"scaled by progression", types.Latency{Fixed: 500 * time.Millisecond}, false, true, time.Minute},
+	}
+	for _, test := range tests {
+		c := Controller{activeConfig: types.Config{Latency: test.latency, TimeProgression: 120}, usingOverrideTime: test.override}
+		if test.learned {
+			c.latency.add(200 * time.Millisecond)
+		}
+		if got := c.lookAhead(); got != test.expected {
+			tt.Errorf("Error with TestLookAhead, %v... Got: %v expected: %v", test.name, got, test.expected)
+		}
+	}
+}
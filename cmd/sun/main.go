@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/mykldog7/heliostat2/pkg/types"
@@ -16,6 +18,14 @@ func main() {
 
 	log.SetFlags(0)
 
+	//Command line arguments (if any)
+	configPath := flag.String("config", "heliostat.json", "config file, created with the defaults if it doesn't exist, empty to not persist config")
+	flag.Parse()
+
+	//SIGHUP reloads the config file
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
 	inwards := make(chan types.Message) //messages coming into the controller
 	publish := make(chan []byte)        //messages to be pushed out to each subscriber
 
@@ -37,6 +47,12 @@ func main() {
 			log.Fatal(err)
 		}
 		Controller := NewController(inwards, publish, grbl)
+		if *configPath != "" {
+			err = Controller.UseConfigFile(*configPath, hup)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
 		err = Controller.Start(ctx)
 		if err != nil {
 			log.Fatalf("Problem with controller %v", err)
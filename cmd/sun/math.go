@@ -5,41 +5,142 @@ import (
 	"math"
 
 	"github.com/256dpi/gcode"
+	sun "github.com/mykldog7/heliostat2/pkg/types"
 )
 
-// PositionToGCode builds a GCode command to send the mirror to the desired azi/alt
-// The mirror's normal is moved to be at the given azi/alt, in degrees
-func PositionToGCode(azi float64, alt float64, azimuth_offset float64, altitude_offset float64) ([]byte, error) {
-	//apply offsets, and wrap if needed
-	command_azi := azi - azimuth_offset
-	if command_azi > 180.0 {
-		command_azi = command_azi - 360.0
+// axes is a position of the mount's axes in degrees, as sent to grbl: X is azimuth and Y is altitude
+type axes struct {
+	Azi, Alt float64
+}
+
+// limits is the range of travel of each axis, in degrees
+type limits struct {
+	AziMin, AziMax float64
+	AltMin, AltMax float64
+}
+
+// defaultLimits are used when the mount's limits aren't configured, an azimuth that can turn all the way around
+// and an altitude from the horizon to vertical
+var defaultLimits = limits{AziMin: -180.0, AziMax: 180.0, AltMin: 0.0, AltMax: 90.0}
+
+// mountLimits converts the configured limits(radians) to degrees, any axis without a range keeps its default
+func mountLimits(m sun.Mount) limits {
+	l := defaultLimits
+	if m.AziLimits.Max > m.AziLimits.Min {
+		l.AziMin, l.AziMax = radToDeg(m.AziLimits.Min), radToDeg(m.AziLimits.Max)
 	}
-	if command_azi < -180.0 {
-		command_azi = command_azi + 360.0
+	if m.AltLimits.Max > m.AltLimits.Min {
+		l.AltMin, l.AltMax = radToDeg(m.AltLimits.Min), radToDeg(m.AltLimits.Max)
 	}
-	command_alt := alt - altitude_offset
-	if command_alt > 90.0 {
-		command_alt = 90.0
+	return l
+}
+
+// LimitError reports a position outside the mount's range of travel
+type LimitError struct {
+	Axis      string
+	Requested float64 // degrees
+	Limit     float64 // degrees, the nearest position that can be reached
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("%v axis can't reach %.3f, limit is %.3f", e.Axis, e.Requested, e.Limit)
+}
+
+// clip moves each axis inside its limits, when any axis is moved a LimitError for the furthest out is returned
+func (l limits) clip(a axes) (axes, error) {
+	var err error
+	worst := 0.0
+	check := func(axis string, v *float64, min float64, max float64) {
+		limit := math.Max(min, math.Min(max, *v))
+		if over := math.Abs(*v - limit); over > worst {
+			worst = over
+			err = LimitError{Axis: axis, Requested: *v, Limit: limit}
+		}
+		*v = limit
 	}
-	if command_alt < 0.0 {
-		command_alt = 0.0
+	check("azimuth", &a.Azi, l.AziMin, l.AziMax)
+	check("altitude", &a.Alt, l.AltMin, l.AltMax)
+	return a, err
+}
+
+// PositionToAxes returns the axes position that points the mirror's normal at the given azi/alt, in degrees
+// of the equivalent azimuths(whole turns apart) within the limits, the one closest to near is used. When flip is allowed the
+// mount may also tilt over the top, (azi+180, 180-alt), whichever pose is within the limits and closest to near is used
+// when the position is out of range a LimitError is returned with the nearest position that can be reached
+func PositionToAxes(azi float64, alt float64, azimuth_offset float64, altitude_offset float64, l limits, near axes, flip bool) (axes, error) {
+	//apply offsets
+	poses := []axes{{Azi: azi - azimuth_offset, Alt: alt - altitude_offset}}
+	if flip {
+		poses = append(poses, axes{Azi: azi + 180.0 - azimuth_offset, Alt: 180.0 - alt - altitude_offset})
 	}
+	var best axes
+	var bestErr error
+	bestScore := math.Inf(1)
+	for _, p := range poses {
+		p.Azi = unwrapAzimuth(p.Azi, near.Azi, l)
+		a, err := l.clip(p)
+		//prefer poses within the limits, then the smallest overshoot, then the shortest move
+		score := math.Max(math.Abs(a.Azi-near.Azi), math.Abs(a.Alt-near.Alt))
+		if limit, ok := err.(LimitError); ok {
+			score += 1e6 * (1 + math.Abs(limit.Requested-limit.Limit))
+		}
+		if score < bestScore {
+			best, bestErr, bestScore = a, err, score
+		}
+	}
+	return best, bestErr
+}
 
-	//check valid azimuth
-	if command_azi > 180.0 || command_azi < -180.0 {
-		return nil, fmt.Errorf("unexpected value for azimuth: %v", command_azi)
+// axesToDirection returns the direction(radians) of the mirror's normal at the axes position, allowing for a mount tilted over the top
+func axesToDirection(a axes, azimuth_offset float64, altitude_offset float64) sun.Direction {
+	azi := degToRad(a.Azi) + azimuth_offset
+	alt := degToRad(a.Alt) + altitude_offset
+	if alt > math.Pi/2 {
+		azi, alt = azi+math.Pi, math.Pi-alt
 	}
-	if command_alt > 90.0 || command_alt < 0.0 {
-		return nil, fmt.Errorf("unexpected value for altitude: %v", command_alt)
+	azi = math.Remainder(azi, 2*math.Pi)
+	return sun.Direction{Azimuth: azi, Altitude: alt}
+}
+
+// unwrapAzimuth returns the azimuth equivalent to azi(plus or minus whole turns) that is closest to near and within the limits,
+// i.e. the shortest rotation the cable wrap allows. If none are within the limits the one closest to near is returned
+func unwrapAzimuth(azi float64, near float64, l limits) float64 {
+	closest := azi + 360.0*math.Round((near-azi)/360.0)
+	best := closest
+	found := false
+	for k := math.Ceil((l.AziMin - azi) / 360.0); azi+k*360.0 <= l.AziMax; k++ {
+		candidate := azi + k*360.0
+		if !found || math.Abs(candidate-near) < math.Abs(best-near) {
+			best, found = candidate, true
+		}
 	}
+	return best
+}
 
+// GCode builds the GCode command to move to the axes position
+func (a axes) GCode() []byte {
 	line := gcode.Line{
 		Codes: make([]gcode.GCode, 0, 2),
 	}
-	line.Codes = append(line.Codes, gcode.GCode{Letter: "X", Value: command_azi})
-	line.Codes = append(line.Codes, gcode.GCode{Letter: "Y", Value: command_alt})
-	return []byte(line.String()), nil
+	line.Codes = append(line.Codes, gcode.GCode{Letter: "X", Value: a.Azi})
+	line.Codes = append(line.Codes, gcode.GCode{Letter: "Y", Value: a.Alt})
+	return []byte(line.String())
+}
+
+// quantise rounds each axis to a whole number of motor steps, a steps per degree of 0 leaves that axis as is
+func (a axes) quantise(aziStepsPerDegree float64, altStepsPerDegree float64) axes {
+	if aziStepsPerDegree > 0 {
+		a.Azi = math.Round(a.Azi*aziStepsPerDegree) / aziStepsPerDegree
+	}
+	if altStepsPerDegree > 0 {
+		a.Alt = math.Round(a.Alt*altStepsPerDegree) / altStepsPerDegree
+	}
+	return a
+}
+
+// within reports if neither axis differs from b by more than tolerance degrees
+func (a axes) within(b axes, tolerance float64) bool {
+	return math.Abs(a.Azi-b.Azi) <= tolerance && math.Abs(a.Alt-b.Alt) <= tolerance
 }
 
 // Utility functions
@@ -67,6 +168,40 @@ func calculateMirrorTarget(pAzi float64, pAlt float64, tAzi float64, tAlt float6
 	return mAzi, mAlt
 }
 
+// calculateMirrorTargetNear is calculateMirrorTarget for a target dist metres from the pivot, with the mirror's centre offset
+// metres in front of the pivot. The centre moves as the mirror turns, so the normal is found iteratively: aim at the target
+// from where the centre is, move the mirror, repeat. With no distance or offset it's the same as calculateMirrorTarget
+func calculateMirrorTargetNear(pAzi float64, pAlt float64, tAzi float64, tAlt float64, dist float64, offset float64) (float64, float64) {
+	mAzi, mAlt := calculateMirrorTarget(pAzi, pAlt, tAzi, tAlt)
+	if dist <= 0 || offset == 0 {
+		return mAzi, mAlt
+	}
+	tx, ty, tz := toCartesianCoords(tAzi, tAlt, dist)
+	for i := 0; i < 20; i++ {
+		//the target as seen from the mirror's centre
+		cx, cy, cz := toCartesianCoords(mAzi, mAlt, offset)
+		aAzi, aAlt, r := toSphericalCoords(tx-cx, ty-cy, tz-cz)
+		if r < 1e-6 {
+			break //the target is on the mirror, nothing sensible to do
+		}
+		nAzi, nAlt := calculateMirrorTarget(pAzi, pAlt, aAzi, aAlt)
+		change := angleBetween(mAzi, mAlt, nAzi, nAlt)
+		mAzi, mAlt = nAzi, nAlt
+		if change < 1e-10 {
+			break
+		}
+	}
+	return mAzi, mAlt
+}
+
+// angleBetween returns the angle between two directions, all in radians
+func angleBetween(aAzi float64, aAlt float64, bAzi float64, bAlt float64) float64 {
+	ax, ay, az := toCartesianCoords(aAzi, aAlt, 1.0)
+	bx, by, bz := toCartesianCoords(bAzi, bAlt, 1.0)
+	dot := ax*bx + ay*by + az*bz
+	return math.Acos(math.Max(-1, math.Min(1, dot)))
+}
+
 // toCartesianCoords returns the cartesian coordinates of the given spherical coordinates, note: this flips the zenith angle
 func toCartesianCoords(azi float64, alt float64, r float64) (float64, float64, float64) {
 	//alt is in latitude, convert to polar angle: zenith is zero not 90.
@@ -88,3 +223,76 @@ func toSphericalCoords(x float64, y float64, z float64) (float64, float64, float
 	alt := (math.Pi / 2) - phi
 	return azi, alt, r
 }
+
+// baseAxes returns the mount's x(zero azimuth), y and z(azimuth axis) unit vectors in the horizontal frame
+func baseAxes(b sun.Base) ([3]float64, [3]float64, [3]float64) {
+	sy, cy := math.Sincos(b.Yaw)
+	sp, cp := math.Sincos(b.Pitch)
+	sr, cr := math.Sincos(b.Roll)
+	//yaw about the vertical, then tip the x axis down(pitch), then the y axis down(roll)
+	x := [3]float64{cp * cy, cp * sy, -sp}
+	z := [3]float64{sp * cy, sp * sy, cp}
+	y := [3]float64{-sy, cy, 0}
+	y, z = [3]float64{cr*y[0] - sr*z[0], cr*y[1] - sr*z[1], cr*y[2] - sr*z[2]}, [3]float64{sr*y[0] + cr*z[0], sr*y[1] + cr*z[1], sr*y[2] + cr*z[2]}
+	return x, y, z
+}
+
+// toMountFrame returns the direction d(horizontal frame) as seen from the mount's tilted base
+func toMountFrame(d sun.Direction, b sun.Base) sun.Direction {
+	if b == (sun.Base{}) {
+		return d
+	}
+	v := [3]float64{}
+	v[0], v[1], v[2] = toCartesianCoords(d.Azimuth, d.Altitude, 1.0)
+	x, y, z := baseAxes(b)
+	dot := func(a [3]float64) float64 { return a[0]*v[0] + a[1]*v[1] + a[2]*v[2] }
+	azi, alt, _ := toSphericalCoords(dot(x), dot(y), dot(z))
+	return sun.Direction{Azimuth: azi, Altitude: alt}
+}
+
+// fromMountFrame returns the direction d, relative to the mount's tilted base, in the horizontal frame
+func fromMountFrame(d sun.Direction, b sun.Base) sun.Direction {
+	if b == (sun.Base{}) {
+		return d
+	}
+	mx, my, mz := toCartesianCoords(d.Azimuth, d.Altitude, 1.0)
+	x, y, z := baseAxes(b)
+	azi, alt, _ := toSphericalCoords(mx*x[0]+my*y[0]+mz*z[0], mx*x[1]+my*y[1]+mz*z[1], mx*x[2]+my*y[2]+mz*z[2])
+	return sun.Direction{Azimuth: azi, Altitude: alt}
+}
+
+// WGS84 ellipsoid
+const (
+	wgs84A  = 6378137.0        // semi-major axis, metres
+	wgs84E2 = 6.69437999014e-3 // first eccentricity squared
+)
+
+// enuToDirection returns the direction(azimuth from south towards west, altitude) and distance of an east, north, up offset
+func enuToDirection(p sun.ENU) (sun.Direction, float64) {
+	//our cartesian frame is x: south, y: west, z: up
+	azi, alt, r := toSphericalCoords(-p.North, -p.East, p.Up)
+	return sun.Direction{Azimuth: azi, Altitude: alt}, r
+}
+
+// geodeticToENU returns the east, north, up offset of point p from the observer at loc
+func geodeticToENU(p sun.Geodetic, loc sun.Location) sun.ENU {
+	px, py, pz := geodeticToECEF(p.Lat, p.Long, p.Height)
+	ox, oy, oz := geodeticToECEF(loc.Lat, loc.Long, loc.Height)
+	dx, dy, dz := px-ox, py-oy, pz-oz
+	lat, long := degToRad(loc.Lat), degToRad(loc.Long)
+	return sun.ENU{
+		East:  -math.Sin(long)*dx + math.Cos(long)*dy,
+		North: -math.Sin(lat)*math.Cos(long)*dx - math.Sin(lat)*math.Sin(long)*dy + math.Cos(lat)*dz,
+		Up:    math.Cos(lat)*math.Cos(long)*dx + math.Cos(lat)*math.Sin(long)*dy + math.Sin(lat)*dz,
+	}
+}
+
+// geodeticToECEF returns the earth centred, earth fixed coordinates(metres) of a position on the ellipsoid
+func geodeticToECEF(latDeg float64, longDeg float64, height float64) (float64, float64, float64) {
+	lat, long := degToRad(latDeg), degToRad(longDeg)
+	n := wgs84A / math.Sqrt(1-wgs84E2*math.Pow(math.Sin(lat), 2))
+	x := (n + height) * math.Cos(lat) * math.Cos(long)
+	y := (n + height) * math.Cos(lat) * math.Sin(long)
+	z := (n*(1-wgs84E2) + height) * math.Sin(lat)
+	return x, y, z
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"math"
 	"testing"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
 )
 
 // testCase defines the target, sun, and expected mirror position(the mid angle)
@@ -23,3 +25,117 @@ func TestMath(tt *testing.T) {
 		}
 	}
 }
+
+func TestQuantise(tt *testing.T) {
+	a := axes{Azi: 10.011, Alt: 45.26}.quantise(40, 0)
+	if a.Azi != 10.0 || a.Alt != 45.26 {
+		tt.Errorf("Error with TestQuantise... Got: %v expected: 10, 45.26", a)
+	}
+	if !a.within(axes{Azi: 10.02, Alt: 45.25}, 0.05) || a.within(axes{Azi: 10.1, Alt: 45.26}, 0.05) {
+		tt.Errorf("Error with TestQuantise... dead-band check failed for %v", a)
+	}
+}
+
+func TestLimits(tt *testing.T) {
+	l := limits{AziMin: -170, AziMax: 170, AltMin: 5, AltMax: 80}
+	a, err := l.clip(axes{Azi: 175, Alt: 95})
+	limit, ok := err.(LimitError)
+	if a.Azi != 170 || a.Alt != 80 || !ok || limit.Axis != "altitude" {
+		tt.Errorf("Error with TestLimits... Got: %v, %v expected: {170 80} and an altitude LimitError", a, err)
+	}
+	if _, err := l.clip(axes{Azi: 0, Alt: 45}); err != nil {
+		tt.Errorf("Error with TestLimits... unexpected error: %v", err)
+	}
+}
+
+func TestUnwrapAzimuth(tt *testing.T) {
+	wrap := limits{AziMin: -270, AziMax: 270, AltMin: 0, AltMax: 90}
+	cases := []struct{ azi, near, expect float64 }{
+		{-170, 175, 190},   //cross the wrap point the short way
+		{-170, 0, -170},    //no need to unwrap
+		{100, 260, 100},    //460 is past the cable limit, the long way is the only way
+		{-170, -520, -170}, //wound past the limits, nearest allowed
+	}
+	for _, t := range cases {
+		if got := unwrapAzimuth(t.azi, t.near, wrap); got != t.expect {
+			tt.Errorf("Error with TestUnwrapAzimuth... Got: %v expected: %v (azi %v near %v)", got, t.expect, t.azi, t.near)
+		}
+	}
+	if got := unwrapAzimuth(190, 0, defaultLimits); got != -170 {
+		tt.Errorf("Error with TestUnwrapAzimuth... Got: %v expected: -170", got)
+	}
+}
+
+func TestFlip(tt *testing.T) {
+	overTheTop := limits{AziMin: -90, AziMax: 90, AltMin: 0, AltMax: 180}
+	//facing north-ish is past the azimuth limit, tilting over the top reaches it
+	a, err := PositionToAxes(170, 60, 0, 0, overTheTop, axes{}, true)
+	if err != nil || a.Azi != -10 || a.Alt != 120 {
+		tt.Errorf("Error with TestFlip... Got: %v, %v expected: {-10 120}", a, err)
+	}
+	if _, err := PositionToAxes(170, 60, 0, 0, overTheTop, axes{}, false); err == nil {
+		tt.Errorf("Error with TestFlip... expected a LimitError without flipping")
+	}
+	//both poses are reachable, stay close to where we are
+	overTheTop.AziMin, overTheTop.AziMax = -180, 180
+	a, _ = PositionToAxes(10, 80, 0, 0, overTheTop, axes{Azi: -170, Alt: 100}, true)
+	if a.Azi != -170 || a.Alt != 100 {
+		tt.Errorf("Error with TestFlip... Got: %v expected: {-170 100}", a)
+	}
+}
+
+func TestTargetPoint(tt *testing.T) {
+	//12m east, 3m north, 2m up
+	d, r := enuToDirection(types.ENU{East: 12, North: 3, Up: 2})
+	if math.Abs(radToDeg(d.Azimuth)+104.036) > 0.001 || math.Abs(radToDeg(d.Altitude)-9.185) > 0.001 || math.Abs(r-12.530) > 0.001 {
+		tt.Errorf("Error with TestTargetPoint... Got: %.3f, %.3f, %.3f expected: -104.036, 9.185, 12.530", radToDeg(d.Azimuth), radToDeg(d.Altitude), r)
+	}
+	//a thousandth of a degree north is about 111m, and just below the horizon because of the earth's curvature
+	loc := types.Location{Lat: -37, Long: 174, Height: 10}
+	p := geodeticToENU(types.Geodetic{Lat: -36.999, Long: 174, Height: 10}, loc)
+	if math.Abs(p.East) > 0.001 || math.Abs(p.North-110.98) > 0.01 || p.Up > 0 || p.Up < -0.01 {
+		tt.Errorf("Error with TestTargetPoint... Got: %+v expected: {East:0 North:110.98 Up:-0.001}", p)
+	}
+}
+
+func TestBaseTilt(tt *testing.T) {
+	//base lower on the south side, the zenith leans towards the mount's north
+	d := toMountFrame(types.Direction{Azimuth: 0, Altitude: math.Pi / 2}, types.Base{Pitch: degToRad(10)})
+	if math.Abs(math.Abs(radToDeg(d.Azimuth))-180) > 1e-6 || math.Abs(radToDeg(d.Altitude)-80) > 1e-6 {
+		tt.Errorf("Error with TestBaseTilt... Got: %.3f, %.3f expected: 180, 80", radToDeg(d.Azimuth), radToDeg(d.Altitude))
+	}
+	//yaw only turns the azimuth
+	d = toMountFrame(types.Direction{Azimuth: 0.5, Altitude: 0.3}, types.Base{Yaw: 0.2})
+	if math.Abs(d.Azimuth-0.3) > 1e-9 || math.Abs(d.Altitude-0.3) > 1e-9 {
+		tt.Errorf("Error with TestBaseTilt... Got: %v expected: {0.3 0.3}", d)
+	}
+	//and back again
+	b := types.Base{Roll: 0.05, Pitch: -0.03, Yaw: 0.4}
+	in := types.Direction{Azimuth: -1.2, Altitude: 0.7}
+	out := fromMountFrame(toMountFrame(in, b), b)
+	if math.Abs(out.Azimuth-in.Azimuth) > 1e-9 || math.Abs(out.Altitude-in.Altitude) > 1e-9 {
+		tt.Errorf("Error with TestBaseTilt... Got: %v expected: %v", out, in)
+	}
+}
+
+func TestParallax(tt *testing.T) {
+	sAzi, sAlt := 0.3, 0.8
+	tAzi, tAlt, dist, offset := 2.5, 0.1, 4.0, 0.3
+	mAzi, mAlt := calculateMirrorTargetNear(sAzi, sAlt, tAzi, tAlt, dist, offset)
+	//reflect the sun in the mirror, from the mirror's centre the reflection should head straight for the target
+	nx, ny, nz := toCartesianCoords(mAzi, mAlt, 1.0)
+	sx, sy, sz := toCartesianCoords(sAzi, sAlt, 1.0)
+	dot := nx*sx + ny*sy + nz*sz
+	rAzi, rAlt, _ := toSphericalCoords(2*dot*nx-sx, 2*dot*ny-sy, 2*dot*nz-sz)
+	cx, cy, cz := toCartesianCoords(mAzi, mAlt, offset)
+	tx, ty, tz := toCartesianCoords(tAzi, tAlt, dist)
+	aAzi, aAlt, _ := toSphericalCoords(tx-cx, ty-cy, tz-cz)
+	if miss := angleBetween(rAzi, rAlt, aAzi, aAlt); miss > 1e-6 {
+		tt.Errorf("Error with TestParallax... Got: reflection %v radians from the target expected: 0", miss)
+	}
+	//the plain bisection misses a near target
+	bAzi, bAlt := calculateMirrorTarget(sAzi, sAlt, tAzi, tAlt)
+	if angleBetween(mAzi, mAlt, bAzi, bAlt) < 0.01 {
+		tt.Errorf("Error with TestParallax... expected the near target to move the normal")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"math"
+	"time"
 
 	sun "github.com/mykldog7/heliostat2/pkg/types"
 )
@@ -21,10 +22,31 @@ func (c *Controller) HandleGetActiveConfig() {
 }
 
 // HandleConfigUpdate updates the 'activeconfig on the controller
-func (c *Controller) HandleConfigUpdate(uc sun.Config) {
+// The update is a partial config, merged with the active config(json merge-patch): fields that are present replace the active
+// values, nested objects are merged and lists are replaced. Setting the target's direction, enu or geodetic position replaces
+// the other forms. The result is validated before it's applied, then broadcast
+func (c *Controller) HandleConfigUpdate(m sun.Message) {
 	log.Printf("UpdateConfig")
-	c.activeConfig.Location.Lat = uc.Location.Lat
-	c.activeConfig.Location.Long = uc.Location.Long
+	uc, changed, err := mergeConfig(c.activeConfig, m.D)
+	if err == nil {
+		err = validateConfig(uc)
+	}
+	if err != nil {
+		log.Printf("Config update rejected: %v", err)
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	old := c.activeConfig
+	c.activeConfig = uc
+	if targetPatched(changed) {
+		c.slew = nil //the new target replaces any slew in progress
+	}
+	c.publish <- sun.NewAckFieldsMessage(changed)
+	c.HandleGetActiveConfig()
+	c.persistConfig()
+	if scheduleChanged(old, uc) {
+		c.applySchedule() //a rule is only applied if a different one is now active
+	}
 }
 
 func (c *Controller) HandleTargetAdjustment(m sun.Message) {
@@ -38,6 +60,11 @@ func (c *Controller) HandleTargetAdjustment(m sun.Message) {
 	if mtr.Amount > maxMoveAmount {
 		mtr.Amount = maxMoveAmount
 	}
+	if c.activeConfig.Corrections.Learn {
+		c.learnNudge(mtr)
+		return
+	}
+	c.useDirectionTarget() //nudges adjust the direction
 	switch mtr.Direction {
 	case "up":
 		c.activeConfig.Target.Altitude += mtr.Amount
@@ -62,9 +89,236 @@ func (c *Controller) HandleTargetAdjustment(m sun.Message) {
 	default:
 		c.publish <- sun.NewAckMessage(false)
 	}
+	c.slew = nil //a nudge replaces any slew in progress
 	log.Printf("New Target is (azi, alt) %.3f, %.3f", radToDeg(c.activeConfig.Target.Azimuth), radToDeg(c.activeConfig.Target.Altitude))
 	//if we got one of the expected directions send an ack
 	if mtr.Direction == "up" || mtr.Direction == "down" || mtr.Direction == "left" || mtr.Direction == "right" {
 		c.publish <- sun.NewAckMessage(true)
+		c.persistConfig()
+	}
+}
+
+// HandleSetTarget moves the target to an absolute position, either straight away or by slewing to it
+func (c *Controller) HandleSetTarget(m sun.Message) {
+	st := sun.SetTarget{}
+	err := json.Unmarshal(m.D, &st)
+	if err != nil {
+		log.Printf("Error unmarshalling: %v", err)
+		c.publish <- sun.NewAckReasonMessage(false, "could not read target")
+		return
+	}
+	target, rate, err := parseSetTarget(st)
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	c.useDirectionTarget()
+	if rate > 0 {
+		c.slew = &targetSlew{to: target, rate: rate, last: time.Now()}
+		c.updateDue = true
+		log.Printf("Slewing target to (azi, alt) %.3f, %.3f", radToDeg(target.Azimuth), radToDeg(target.Altitude))
+	} else {
+		c.slew = nil
+		c.activeConfig.Target.Direction = target
+		log.Printf("New Target is (azi, alt) %.3f, %.3f", radToDeg(target.Azimuth), radToDeg(target.Altitude))
+		c.persistConfig()
+	}
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// HandleGetActiveRule publishes the schedule rule currently being applied
+func (c *Controller) HandleGetActiveRule() {
+	c.publish <- sun.NewMessage("ActiveRule", c.activeRuleInfo())
+}
+
+// HandleModeRequest asks the state machine to change mode, the ack explains any rejection
+func (c *Controller) HandleModeRequest(m sun.Message) {
+	rm := sun.RequestMode{}
+	err := json.Unmarshal(m.D, &rm)
+	if err != nil {
+		log.Printf("Error unmarshalling: %v", err)
+		c.publish <- sun.NewAckReasonMessage(false, "could not read mode request")
+		return
+	}
+	err = c.requestMode(rm.Mode, "requested by client")
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// HandleGetMode publishes the current operating mode
+func (c *Controller) HandleGetMode() {
+	c.publish <- sun.NewMessage("Mode", c.modeStatus)
+}
+
+// HandleGetLatency publishes the move latency estimate, and how far ahead positions are calculated
+func (c *Controller) HandleGetLatency() {
+	c.publish <- sun.NewMessage("Latency", c.latencyStatus())
+}
+
+// HandleGetUpdatePeriod publishes the period chosen until the next update
+func (c *Controller) HandleGetUpdatePeriod() {
+	c.publish <- sun.NewMessage("UpdatePeriod", c.periodStatus())
+}
+
+// HandleGetReachability publishes whether the mirror can reach the position it needs to be in
+func (c *Controller) HandleGetReachability() {
+	c.publish <- sun.NewMessage("Reachability", c.reachability)
+}
+
+// HandleJog moves the axes directly by the given amounts(degrees), only in manual mode, e.g. to put the reflection on the target
+func (c *Controller) HandleJog(m sun.Message) {
+	jog := sun.JogAxes{}
+	err := json.Unmarshal(m.D, &jog)
+	if err != nil {
+		log.Printf("Error unmarshalling: %v", err)
+		c.publish <- sun.NewAckReasonMessage(false, "could not read jog")
+		return
+	}
+	if c.opMode != sun.Manual || !c.haveCommanded {
+		c.publish <- sun.NewAckReasonMessage(false, "axes can only be jogged in manual mode, after homing")
+		return
+	}
+	target := axes{Azi: c.commanded.Azi + jog.Azimuth, Alt: c.commanded.Alt + jog.Altitude}
+	target, err = mountLimits(c.activeConfig.Mount).clip(target)
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	err = c.moveTo(target)
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// HandleRecordObservation records where the axes are, and where the model says they should be, as a calibration observation.
+// The operator sends this once the reflection is on the target
+func (c *Controller) HandleRecordObservation() {
+	if !c.haveCommanded {
+		c.publish <- sun.NewAckReasonMessage(false, "axes position unknown, home first")
+		return
+	}
+	t := c.cTime()
+	sAzi, sAlt := c.sourcePosition(t) //moonlight works as well as sunlight
+	target, dist := c.targetDirection()
+	mAzi, mAlt := calculateMirrorTargetNear(sAzi, sAlt, target.Azimuth, target.Altitude, dist, c.activeConfig.Mount.MirrorOffset)
+	if c.directTracker() {
+		mAzi, mAlt = sAzi, sAlt //the operator has centred the source on the device, e.g. with a sight
+	}
+	o := sun.Observation{
+		Time:    t,
+		Sun:     sun.Direction{Azimuth: sAzi, Altitude: sAlt},
+		Target:  target,
+		Mirror:  sun.Direction{Azimuth: mAzi, Altitude: mAlt},
+		AxesAzi: c.commanded.Azi,
+		AxesAlt: c.commanded.Alt,
+	}
+	c.activeConfig.Calibration.Observations = append(c.activeConfig.Calibration.Observations, o)
+	log.Printf("Recorded calibration observation %d", len(c.activeConfig.Calibration.Observations))
+	c.persistConfig()
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// HandleFitCalibration fits the pointing model to the recorded observations, and starts using it
+func (c *Controller) HandleFitCalibration() {
+	cal := &c.activeConfig.Calibration
+	m, err := fitPointingModel(cal.Observations, c.activeConfig.AziOffset, c.activeConfig.AltOffset, c.activeConfig.Mount.Base)
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	m.Fitted = c.cTime()
+	cal.Model, cal.Enabled = m, true
+	log.Printf("Fitted pointing model to %d observations, rms error %.4f degrees", len(cal.Observations), radToDeg(m.RMS))
+	c.persistConfig()
+	c.publish <- sun.NewAckMessage(true)
+	c.HandleGetCalibration()
+}
+
+// HandleClearCalibration removes the pointing model and its observations
+func (c *Controller) HandleClearCalibration() {
+	c.activeConfig.Calibration = sun.Calibration{}
+	c.persistConfig()
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// HandleGetCalibration publishes the pointing model and its observations
+func (c *Controller) HandleGetCalibration() {
+	c.publish <- sun.NewMessage("Calibration", c.activeConfig.Calibration)
+}
+
+// HandleGetCorrections publishes the table of corrections learned from nudges
+func (c *Controller) HandleGetCorrections() {
+	c.publish <- sun.NewMessage("Corrections", c.activeConfig.Corrections)
+}
+
+// HandleClearCorrections empties the table of corrections learned from nudges, learning stays on/off
+func (c *Controller) HandleClearCorrections() {
+	c.activeConfig.Corrections.Points = nil
+	log.Printf("Cleared learned corrections")
+	c.persistConfig()
+	c.publish <- sun.NewAckMessage(true)
+}
+
+// HandleExportCorrections publishes the table of corrections as csv(degrees), for use in a spreadsheet
+func (c *Controller) HandleExportCorrections() {
+	c.publish <- sun.NewMessage("CorrectionsCSV", correctionsCSV(c.activeConfig.Corrections.Points))
+}
+
+// HandleInclinometer sets the base's roll and pitch from an inclinometer reading on the mount, the yaw is unchanged
+func (c *Controller) HandleInclinometer(m sun.Message) {
+	r := sun.Inclinometer{}
+	err := json.Unmarshal(m.D, &r)
+	if err != nil {
+		log.Printf("Error unmarshalling: %v", err)
+		c.publish <- sun.NewAckReasonMessage(false, "could not read inclinometer reading")
+		return
+	}
+	cfg := c.activeConfig
+	cfg.Mount.Base.Roll, cfg.Mount.Base.Pitch = r.Roll, r.Pitch
+	err = validateConfig(cfg)
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
+	}
+	c.activeConfig = cfg
+	log.Printf("Base level set to roll %.3f, pitch %.3f degrees", radToDeg(r.Roll), radToDeg(r.Pitch))
+	c.persistConfig()
+	c.publish <- sun.NewAckFieldsMessage([]string{"mount.base.pitch", "mount.base.roll"})
+}
+
+// HandleGetSunEvents publishes today's sun events, for the configured location
+func (c *Controller) HandleGetSunEvents() {
+	c.publish <- sun.NewMessage("SunEvents", sunEvents(c.cTime(), c.activeConfig.Location))
+}
+
+// HandleGetOptics publishes how effectively the mirror was reflecting the sun, as of the last tracking update
+func (c *Controller) HandleGetOptics() {
+	c.publish <- sun.NewMessage("Optics", c.optics)
+}
+
+// HandleGetSpot publishes an estimate of the reflected spot at the requested time, or now
+func (c *Controller) HandleGetSpot(m sun.Message) {
+	req := sun.GetSpot{}
+	if len(m.D) > 0 {
+		err := json.Unmarshal(m.D, &req)
+		if err != nil {
+			log.Printf("Error unmarshalling: %v", err)
+			c.publish <- sun.NewAckReasonMessage(false, "could not read spot request")
+			return
+		}
+	}
+	if req.Time.IsZero() {
+		req.Time = c.cTime()
+	}
+	spot, err := c.spotAt(req.Time)
+	if err != nil {
+		c.publish <- sun.NewAckReasonMessage(false, err.Error())
+		return
 	}
+	c.publish <- sun.NewMessage("Spot", spot)
 }
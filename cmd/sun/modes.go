@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// transitions lists the modes that can be entered from each mode
+var transitions = map[sun.OperatingMode][]sun.OperatingMode{
+	sun.Initialising: {sun.Homing, sun.Faulted, sun.Stopped},
+	sun.Homing:       {sun.Tracking, sun.Manual, sun.Parked, sun.Faulted, sun.Stopped},
+	sun.Tracking:     {sun.Manual, sun.Parked, sun.Stowed, sun.Homing, sun.Faulted, sun.Stopped},
+	sun.Manual:       {sun.Tracking, sun.Parked, sun.Stowed, sun.Homing, sun.Faulted, sun.Stopped},
+	sun.Parked:       {sun.Tracking, sun.Manual, sun.Stowed, sun.Homing, sun.Faulted, sun.Stopped},
+	sun.Stowed:       {sun.Manual, sun.Parked, sun.Homing, sun.Faulted, sun.Stopped}, //must un-stow(park) before tracking
+	sun.Faulted:      {sun.Homing, sun.Stopped},                                      //re-home to recover
+	sun.Stopped:      {},
+}
+
+// scheduleModes maps the mode a schedule rule selects to the operating mode it requests
+var scheduleModes = map[string]sun.OperatingMode{
+	sun.ModeTarget: sun.Tracking,
+	sun.ModePark:   sun.Parked,
+	sun.ModeIdle:   sun.Manual,
+}
+
+// checkTransition returns an error explaining why the transition isn't allowed, or nil if it is
+func checkTransition(from, to sun.OperatingMode) error {
+	if _, ok := transitions[to]; !ok {
+		return fmt.Errorf("unknown mode %q", to)
+	}
+	for _, m := range transitions[from] {
+		if m == to {
+			return nil
+		}
+	}
+	if from == to {
+		return fmt.Errorf("already %v", to)
+	}
+	return fmt.Errorf("can't change from %v to %v", from, to)
+}
+
+// setMode moves the state machine to a new mode, announcing the change to clients
+func (c *Controller) setMode(to sun.OperatingMode, reason string) error {
+	err := checkTransition(c.opMode, to)
+	if err != nil {
+		return err
+	}
+	log.Printf("Mode %v -> %v (%v)", c.opMode, to, reason)
+	c.modeStatus = sun.ModeStatus{Mode: to, Previous: c.opMode, Reason: reason, Since: time.Now()}
+	c.opMode = to
+	c.updateDue = true
+	c.publish <- sun.NewMessage("Mode", c.modeStatus)
+	return nil
+}
+
+// requestMode is used for changes asked for by clients and the schedule, homing is completed immediately
+func (c *Controller) requestMode(to sun.OperatingMode, reason string) error {
+	if to == sun.Homing && !c.haveCommanded && c.opMode != sun.Initialising && c.opMode != sun.Faulted {
+		return fmt.Errorf("axes position unknown, can only home from %v or %v", sun.Initialising, sun.Faulted)
+	}
+	err := c.setMode(to, reason)
+	if err != nil || to != sun.Homing {
+		return err
+	}
+	return c.home()
+}
+
+// home sets the mount's zero position, then starts tracking(or whatever the schedule asks for). When we know where the axes were sent they're driven
+// back to zero first, otherwise(Initialising or Faulted) the operator must have positioned the mount at zero by hand,
+// wherever the axes are becomes the zero position
+func (c *Controller) home() error {
+	if c.haveCommanded {
+		_, err := c.grbl.GrblSendCommandGetResponse(axes{}.GCode())
+		if err == nil {
+			err = c.grbl.WaitForIdle(time.Minute)
+		}
+		if err != nil {
+			c.fault(fmt.Errorf("homing failed, could not return to zero: %v", err))
+			return err
+		}
+	}
+	_, err := c.grbl.GrblSendCommandGetResponse([]byte("G92 X0 Y0 Z0\n"))
+	if err != nil {
+		c.fault(fmt.Errorf("homing failed: %v", err))
+		return err
+	}
+	log.Printf("Set current machine position to 0 azimuth, 0 altitude.")
+	c.commanded, c.haveCommanded = axes{}, true
+	c.activeRule = -1 //homing always ends tracking, the next update re-applies a park or idle rule that's still active
+	return c.setMode(sun.Tracking, "homing complete")
+}
+
+// fault moves the controller to the Faulted mode, no further moves are sent until it is homed again
+func (c *Controller) fault(err error) {
+	log.Printf("Fault: %v", err)
+	if c.opMode == sun.Faulted || c.opMode == sun.Stopped {
+		return
+	}
+	c.setMode(sun.Faulted, err.Error())
+}
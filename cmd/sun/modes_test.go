@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+type transitionCase struct {
+	from, to types.OperatingMode
+	allowed  bool
+}
+
+var transitionCases = []transitionCase{
+	{types.Stowed, types.Tracking, false}, //must un-stow first
+	{types.Stowed, types.Parked, true},
+	{types.Faulted, types.Homing, true},
+	{types.Faulted, types.Tracking, false},
+	{types.Initialising, types.Homing, true},
+	{types.Tracking, types.Tracking, false},
+	{types.Stopped, types.Homing, false}, //stopped is terminal
+	{types.Stopped, types.Tracking, false},
+	{types.Tracking, "Dancing", false},
+}
+
+func TestTransitions(tt *testing.T) {
+	for _, t := range transitionCases {
+		err := checkTransition(t.from, t.to)
+		if (err == nil) != t.allowed {
+			tt.Errorf("Error with TestTransitions %v -> %v... Got: %v expected allowed: %v", t.from, t.to, err, t.allowed)
+		}
+	}
+	if len(transitions[types.Stopped]) != 0 {
+		tt.Errorf("Error with TestTransitions... expected no transitions out of %v", types.Stopped)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+const solarConstant = 1353.0 // W/m², as used by the Meinel model
+
+// clearSkyDNI estimates the direct normal irradiance(W/m²) with the sun at altitude alt(radians), for a site height metres
+// above sea level. Meinel's model with Laue's height correction, the air mass is from Kasten and Young
+func clearSkyDNI(alt float64, height float64) float64 {
+	if alt <= 0 {
+		return 0
+	}
+	zenith := 90 - radToDeg(alt)
+	am := 1 / (math.Cos(degToRad(zenith)) + 0.50572*math.Pow(96.07995-zenith, -1.6364))
+	h := math.Max(0, height/1000)
+	return solarConstant * ((1-0.14*h)*math.Pow(0.7, math.Pow(am, 0.678)) + 0.14*h)
+}
+
+// calculateOptics works out how effectively the device is using the light from source, with its normal pointing at normal
+func calculateOptics(t time.Time, source sun.Direction, normal sun.Direction, dni float64, m sun.Mirror) sun.Optics {
+	incidence := angleBetween(source.Azimuth, source.Altitude, normal.Azimuth, normal.Altitude)
+	o := sun.Optics{
+		Time:             t,
+		Incidence:        incidence,
+		CosineEfficiency: math.Max(0, math.Cos(incidence)),
+		DNI:              dni,
+	}
+	o.Reflected = dni * o.CosineEfficiency * m.Reflectivity
+	o.Power = o.Reflected * m.Width * m.Height
+	return o
+}
+
+// updateOptics records the optical performance now, with the mirror where it was last sent. Only sunlight is counted
+// towards the power, and nothing is reported until the mirror's position is known
+func (c *Controller) updateOptics() {
+	t := c.cTime()
+	if !c.haveCommanded {
+		c.optics = sun.Optics{Time: t}
+		return
+	}
+	var source sun.Direction
+	source.Azimuth, source.Altitude = c.sourcePosition(t)
+	normal := c.axesDirection(c.commanded)
+	dni := 0.0
+	if c.sourceKind() == sun.SourceSun {
+		dni = clearSkyDNI(source.Altitude, c.activeConfig.Location.Height)
+	}
+	m := c.activeConfig.Mirror
+	if c.directTracker() {
+		m.Reflectivity = 1 //nothing is reflected, report what falls on the device
+	}
+	c.optics = calculateOptics(t, source, normal, dni, m)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+func TestOptics(tt *testing.T) {
+	if dni := clearSkyDNI(math.Pi/2, 0); math.Abs(dni-947.1) > 0.5 {
+		tt.Errorf("Error with TestOptics, dni at the zenith... Got: %.1f expected: 947.1", dni)
+	}
+	if dni := clearSkyDNI(-0.1, 0); dni != 0 {
+		tt.Errorf("Error with TestOptics, dni at night... Got: %.1f expected: 0", dni)
+	}
+	//sun 30 degrees from the mirror's normal
+	m := types.Mirror{Width: 2, Height: 1, Reflectivity: 0.9}
+	o := calculateOptics(time.Now(), types.Direction{Altitude: math.Pi / 3}, types.Direction{Altitude: math.Pi / 2}, 1000, m)
+	if math.Abs(radToDeg(o.Incidence)-30) > 1e-6 || math.Abs(o.CosineEfficiency-0.8660) > 1e-4 || math.Abs(o.Power-1558.8) > 0.1 {
+		tt.Errorf("Error with TestOptics... Got: %+v expected: incidence 30 degrees, efficiency 0.866, power 1558.8", o)
+	}
+}
+
+func TestSpot(tt *testing.T) {
+	m := types.Mirror{Width: 1, Height: 1, Reflectivity: 0.9}
+	overhead := types.Direction{Altitude: math.Pi / 2}
+	target := types.Direction{} //10m away to the south, on the horizon
+	normal := types.Direction{Altitude: math.Pi / 4}
+	s, err := estimateSpot(overhead, normal, target, 10, 0, nil, m, defaultSourceDiameter)
+	if err != nil || math.Abs(s.Width-1.0418) > 1e-4 || s.Offset > 1e-9 || math.Abs(s.Length-s.Width) > 1e-9 {
+		tt.Errorf("Error with TestSpot... Got: %+v, %v expected: width 1.0418, no offset", s, err)
+	}
+	//tipping the mirror up moves the spot up by twice as much
+	normal.Altitude += 0.001
+	s, _ = estimateSpot(overhead, normal, target, 10, 0, nil, m, defaultSourceDiameter)
+	if math.Abs(s.OffsetUp-0.02) > 1e-4 || math.Abs(s.OffsetRight) > 1e-9 || math.Abs(s.BeamError-0.002) > 1e-6 {
+		tt.Errorf("Error with TestSpot... Got: %+v expected: 0.02m up", s)
+	}
+	//a target surface facing straight up stretches the spot
+	s, err = estimateSpot(overhead, types.Direction{Altitude: math.Pi / 6}, types.Direction{Altitude: -math.Pi / 6}, 10, 0, &overhead, m, defaultSourceDiameter)
+	if err != nil || math.Abs(s.Length/s.Width-2) > 1e-6 {
+		tt.Errorf("Error with TestSpot... Got: length %v width %v, %v expected: twice as long as wide", s.Length, s.Width, err)
+	}
+	//the beam leaves from the mirror's centre, in front of the pivot, tracking allows for that
+	sun := types.Direction{Azimuth: 0.3, Altitude: 0.6}
+	east := types.Direction{Azimuth: -math.Pi / 2}
+	normal.Azimuth, normal.Altitude = calculateMirrorTargetNear(sun.Azimuth, sun.Altitude, east.Azimuth, east.Altitude, 3, 0.2)
+	s, err = estimateSpot(sun, normal, east, 3, 0.2, nil, m, defaultSourceDiameter)
+	if err != nil || s.Offset > 1e-6 || s.BeamError > 1e-6 {
+		tt.Errorf("Error with TestSpot, mirror offset... Got: %+v, %v expected: no offset", s, err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// rateInterval is how far apart the mirror positions used to estimate its angular rate are
+const rateInterval = time.Minute
+
+// mirrorRate returns the angular rate of the mirror's normal at time t while tracking, in radians per second of controller time
+func (c *Controller) mirrorRate(t time.Time) float64 {
+	target, _ := c.targetDirection()
+	aAzi, aAlt := c.sourcePosition(t)
+	bAzi, bAlt := c.sourcePosition(t.Add(rateInterval))
+	if !c.directTracker() {
+		aAzi, aAlt = calculateMirrorTarget(aAzi, aAlt, target.Azimuth, target.Altitude)
+		bAzi, bAlt = calculateMirrorTarget(bAzi, bAlt, target.Azimuth, target.Altitude)
+	}
+	return angleBetween(aAzi, aAlt, bAzi, bAlt) / rateInterval.Seconds()
+}
+
+// nextUpdatePeriod chooses how long to wait before the next update, so the mirror drifts no further than the allowed error
+// without an adaptive configuration the fixed update period is used
+func (c *Controller) nextUpdatePeriod() time.Duration {
+	cfg := c.activeConfig.UpdatePeriod
+	if cfg.Max <= 0 || cfg.MaxError <= 0 {
+		return c.updatePeriod
+	}
+	if c.opMode != sun.Tracking {
+		c.rate = 0
+		return cfg.Max //holding still, just keep an eye on things
+	}
+	c.rate = c.mirrorRate(c.cTime())
+	if c.usingOverrideTime {
+		c.rate *= c.activeConfig.TimeProgression //per second of real time
+	}
+	period := cfg.Max
+	if c.rate > 0 {
+		p := time.Duration(cfg.MaxError / c.rate * float64(time.Second))
+		if p < period {
+			period = p
+		}
+	}
+	if c.slew != nil && period > c.updatePeriod {
+		period = c.updatePeriod //keep the target slew smooth
+	}
+	if period < cfg.Min {
+		period = cfg.Min
+	}
+	return period
+}
+
+// periodStatus describes the chosen update period for clients
+func (c *Controller) periodStatus() sun.UpdatePeriodStatus {
+	return sun.UpdatePeriodStatus{
+		Period:     c.period,
+		MirrorRate: c.rate,
+		Adaptive:   c.activeConfig.UpdatePeriod.Max > 0 && c.activeConfig.UpdatePeriod.MaxError > 0,
+	}
+}
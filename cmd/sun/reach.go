@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// handleUnreachable applies the configured policy when the mirror can't reach the required position(mAzi, mAlt in radians)
+// nearest is the closest reachable position, returns the position to move to, or false if the mirror should stay put
+func (c *Controller) handleUnreachable(mAzi float64, mAlt float64, nearest axes, limit LimitError) (axes, bool) {
+	policy := c.activeConfig.Unreachable
+	if policy == "" {
+		policy = sun.UnreachableBestEffort
+	}
+	n := c.axesDirection(nearest)
+	c.setReachability(sun.Reachability{
+		Reachable: false,
+		Shortfall: angleBetween(mAzi, mAlt, n.Azimuth, n.Altitude),
+		Reason:    limit.Error(),
+		Policy:    policy,
+		Time:      c.cTime(),
+	})
+
+	switch policy {
+	case sun.UnreachableHold:
+		return axes{}, false
+	case sun.UnreachablePark:
+		target, err := c.directionAxes(c.activeConfig.Park) //the same position as the Parked mode
+		if err != nil {
+			log.Printf("Park position clipped: %v", err)
+		}
+		return target, true
+	}
+	return nearest, true
+}
+
+// setReachability records the latest reachability, clients are told when the mirror becomes unreachable, or reachable again
+func (c *Controller) setReachability(r sun.Reachability) {
+	changed := r.Reachable != c.reachability.Reachable
+	if r.Reachable {
+		r.Time = c.cTime()
+	}
+	c.reachability = r
+	if !changed {
+		return
+	}
+	if r.Reachable {
+		log.Printf("Mirror position reachable again")
+	} else {
+		log.Printf("Mirror position unreachable (%v), short by %.3f degrees, policy: %v", r.Reason, radToDeg(r.Shortfall), r.Policy)
+	}
+	c.publish <- sun.NewMessage("Reachability", r)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+	"github.com/sixdouglas/suncalc"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// activeRule returns the index of the first rule in the schedule that applies at time t, or -1 if none do
+// rules that can't be evaluated(bad clock time, unknown event etc.) are logged and skipped
+func activeRule(rules []types.ScheduleRule, t time.Time, loc types.Location) int {
+	for i, r := range rules {
+		ok, err := ruleApplies(r, t, loc)
+		if err != nil {
+			log.Printf("Skipping schedule rule %d (%v): %v", i, r.Name, err)
+			continue
+		}
+		if ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// ruleApplies checks if t falls inside the rule's window, on one of its days
+func ruleApplies(r types.ScheduleRule, t time.Time, loc types.Location) (bool, error) {
+	if r.Mode != types.ModeTarget && r.Mode != types.ModePark && r.Mode != types.ModeIdle {
+		return false, fmt.Errorf("unknown mode %q", r.Mode)
+	}
+	if len(r.Phases) > 0 {
+		ok, err := ruleInPhase(r, t, loc)
+		if !ok || err != nil {
+			return false, err
+		}
+		if r.Start == (types.TimeOfDay{}) && r.End == (types.TimeOfDay{}) {
+			return ruleOnDay(r, t) //no window, the phase is enough
+		}
+	}
+	start, err := resolveTimeOfDay(r.Start, t, loc)
+	if err != nil {
+		return false, fmt.Errorf("start: %v", err)
+	}
+	end, err := resolveTimeOfDay(r.End, t, loc)
+	if err != nil {
+		return false, fmt.Errorf("end: %v", err)
+	}
+	day := t
+	if end.After(start) {
+		if t.Before(start) || !t.Before(end) {
+			return false, nil
+		}
+	} else {
+		//window runs past midnight, early morning times belong to the window that started yesterday
+		switch {
+		case t.Before(end):
+			day = t.AddDate(0, 0, -1)
+		case !t.Before(start):
+		default:
+			return false, nil
+		}
+	}
+	return ruleOnDay(r, day)
+}
+
+// validateRule checks everything about a rule that doesn't depend on the time, so a bad rule is caught when it's
+// configured rather than when it would first apply
+func validateRule(r types.ScheduleRule, loc types.Location) error {
+	if r.Mode != types.ModeTarget && r.Mode != types.ModePark && r.Mode != types.ModeIdle {
+		return fmt.Errorf("unknown mode %q", r.Mode)
+	}
+	for _, p := range r.Phases {
+		if !validPhase(p) {
+			return fmt.Errorf("unknown day phase %q", p)
+		}
+	}
+	if len(r.Phases) == 0 || r.Start != (types.TimeOfDay{}) || r.End != (types.TimeOfDay{}) {
+		day := time.Date(2023, 3, 21, 0, 0, 0, 0, time.UTC) //any day will do, sun events happen everywhere at the equinox
+		if _, err := resolveTimeOfDay(r.Start, day, loc); err != nil {
+			return fmt.Errorf("start: %v", err)
+		}
+		if _, err := resolveTimeOfDay(r.End, day, loc); err != nil {
+			return fmt.Errorf("end: %v", err)
+		}
+	}
+	for _, d := range r.Weekdays {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown weekday %q", d)
+		}
+	}
+	for _, bound := range []string{r.From, r.Until} {
+		if bound == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", bound); err != nil {
+			return fmt.Errorf("bad date %q, expected yyyy-mm-dd", bound)
+		}
+	}
+	return nil
+}
+
+// ruleInPhase checks if t is in one of the rule's day phases
+func ruleInPhase(r types.ScheduleRule, t time.Time, loc types.Location) (bool, error) {
+	phase := dayPhase(t, loc)
+	found := false
+	for _, p := range r.Phases {
+		if !validPhase(p) {
+			return false, fmt.Errorf("unknown day phase %q", p)
+		}
+		found = found || p == phase
+	}
+	return found, nil
+}
+
+// ruleOnDay checks the rule's weekday and date range restrictions
+func ruleOnDay(r types.ScheduleRule, day time.Time) (bool, error) {
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, d := range r.Weekdays {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return false, fmt.Errorf("unknown weekday %q", d)
+			}
+			if wd == day.Weekday() {
+				found = true
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	date := day.Format("2006-01-02")
+	for _, bound := range []string{r.From, r.Until} {
+		if bound == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", bound); err != nil {
+			return false, fmt.Errorf("bad date %q, expected yyyy-mm-dd", bound)
+		}
+	}
+	if r.From != "" && date < r.From {
+		return false, nil
+	}
+	if r.Until != "" && date > r.Until {
+		return false, nil
+	}
+	return true, nil
+}
+
+// resolveTimeOfDay returns the moment on the same date as day that tod refers to
+func resolveTimeOfDay(tod types.TimeOfDay, day time.Time, loc types.Location) (time.Time, error) {
+	offset := time.Duration(tod.Offset * float64(time.Minute))
+	y, m, d := day.Date()
+	switch {
+	case tod.Clock != "":
+		clock, err := time.Parse("15:04", tod.Clock)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad clock time %q, expected hh:mm", tod.Clock)
+		}
+		return time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, day.Location()).Add(offset), nil
+	case tod.Event != "":
+		noon := time.Date(y, m, d, 12, 0, 0, 0, day.Location())
+		times := suncalc.GetTimes(noon, loc.Lat, loc.Long)
+		event, ok := times[suncalc.DayTimeName(tod.Event)]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown sun event %q", tod.Event)
+		}
+		return event.Value.In(day.Location()).Add(offset), nil
+	}
+	return time.Time{}, fmt.Errorf("needs either a clock time or a sun event")
+}
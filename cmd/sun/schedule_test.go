@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+var auckland = types.Location{Lat: -37.0112, Long: 174.7857}
+
+var rules = []types.ScheduleRule{
+	{Name: "weekday kitchen", Start: types.TimeOfDay{Event: "sunrise"}, End: types.TimeOfDay{Clock: "11:30"}, Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}, Mode: types.ModeTarget},
+	{Name: "greenhouse", Start: types.TimeOfDay{Event: "solarNoon", Offset: -60}, End: types.TimeOfDay{Event: "sunset", Offset: -30}, Mode: types.ModeTarget},
+	{Name: "night", Start: types.TimeOfDay{Clock: "22:00"}, End: types.TimeOfDay{Clock: "05:00"}, From: "2023-01-01", Until: "2023-01-31", Mode: types.ModePark},
+}
+
+type scheduleCase struct {
+	t      time.Time
+	expect int
+}
+
+var nz = time.FixedZone("NZDT", 13*60*60)
+
+var scheduleCases = []scheduleCase{
+	{time.Date(2023, 1, 2, 8, 0, 0, 0, nz), 0},   //monday morning
+	{time.Date(2023, 1, 1, 8, 0, 0, 0, nz), -1},  //sunday morning
+	{time.Date(2023, 1, 2, 4, 0, 0, 0, nz), 2},   //before sunrise, night rule started the day before
+	{time.Date(2023, 1, 2, 15, 0, 0, 0, nz), 1},  //afternoon
+	{time.Date(2023, 1, 2, 23, 0, 0, 0, nz), 2},  //late evening
+	{time.Date(2023, 2, 2, 23, 0, 0, 0, nz), -1}, //after the night rule's date range
+	{time.Date(2023, 1, 1, 4, 0, 0, 0, nz), -1},  //night rule window started the day before it's first date
+}
+
+func TestSchedule(tt *testing.T) {
+	for _, t := range scheduleCases {
+		if got := activeRule(rules, t.t, auckland); got != t.expect {
+			tt.Errorf("Error with TestSchedule at %v... Got: %v expected: %v", t.t, got, t.expect)
+		}
+	}
+}
+
+func TestScheduleBadRule(tt *testing.T) {
+	bad := []types.ScheduleRule{{Name: "typo", Start: types.TimeOfDay{Event: "sunup"}, End: types.TimeOfDay{Clock: "12:00"}, Mode: types.ModePark}}
+	if _, err := ruleApplies(bad[0], scheduleCases[0].t, auckland); err == nil {
+		tt.Errorf("Expected an error for unknown sun event")
+	}
+	if got := activeRule(bad, scheduleCases[0].t, auckland); got != -1 {
+		tt.Errorf("Expected bad rule to be skipped, got: %v", got)
+	}
+}
+
+func TestDayPhase(tt *testing.T) {
+	e := sunEvents(time.Date(2023, 1, 2, 0, 0, 0, 0, nz), auckland)
+	cases := []struct {
+		t      time.Time
+		expect string
+	}{
+		{e.Dawn.Add(-time.Minute), types.PhaseNight},
+		{e.Dawn.Add(time.Minute), types.PhaseDawn},
+		{e.SolarNoon, types.PhaseDay},
+		{e.Sunset.Add(time.Minute), types.PhaseDusk},
+		{e.Dusk.Add(time.Minute), types.PhaseNight},
+	}
+	for _, c := range cases {
+		if got := dayPhase(c.t, auckland); got != c.expect {
+			tt.Errorf("Error with TestDayPhase at %v... Got: %v expected: %v", c.t, got, c.expect)
+		}
+	}
+	//a rule with only a phase applies whenever it's that phase
+	night := types.ScheduleRule{Name: "night", Phases: []string{types.PhaseNight}, Mode: types.ModePark}
+	if ok, err := ruleApplies(night, e.Dusk.Add(time.Hour), auckland); !ok || err != nil {
+		tt.Errorf("Error with TestDayPhase... Got: %v, %v expected the night rule to apply", ok, err)
+	}
+	if ok, _ := ruleApplies(night, e.SolarNoon, auckland); ok {
+		tt.Errorf("Error with TestDayPhase... expected the night rule not to apply at noon")
+	}
+}
+
+func TestValidateRule(tt *testing.T) {
+	window := func(r types.ScheduleRule) types.ScheduleRule {
+		r.Start, r.End, r.Mode = types.TimeOfDay{Clock: "08:00"}, types.TimeOfDay{Clock: "09:00"}, types.ModePark
+		return r
+	}
+	cases := []struct {
+		name  string
+		rule  types.ScheduleRule
+		valid bool
+	}{
+		{"window", window(types.ScheduleRule{}), true},
+		{"weekday typo outside the window", window(types.ScheduleRule{Weekdays: []string{"mnday"}}), false},
+		{"bad date", window(types.ScheduleRule{Until: "2023-13-01"}), false},
+		{"bad clock", types.ScheduleRule{Start: types.TimeOfDay{Clock: "8am"}, End: types.TimeOfDay{Clock: "09:00"}, Mode: types.ModePark}, false},
+		{"bad event", types.ScheduleRule{Start: types.TimeOfDay{Event: "sunup"}, End: types.TimeOfDay{Clock: "09:00"}, Mode: types.ModePark}, false},
+		{"no window", types.ScheduleRule{Mode: types.ModePark}, false},
+		{"phase only", types.ScheduleRule{Phases: []string{types.PhaseNight}, Mode: types.ModePark}, true},
+		{"bad phase", types.ScheduleRule{Phases: []string{"evening"}, Mode: types.ModePark}, false},
+		{"bad mode", types.ScheduleRule{Phases: []string{types.PhaseNight}, Mode: "dance"}, false},
+	}
+	for _, c := range cases {
+		if err := validateRule(c.rule, auckland); (err == nil) != c.valid {
+			tt.Errorf("Error with TestValidateRule, %v... Got: %v expected valid: %v", c.name, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+	"github.com/sixdouglas/suncalc"
+)
+
+// sourcePosition returns the azimuth and altitude at time t of the light being reflected, usually the sun
+func (c *Controller) sourcePosition(t time.Time) (float64, float64) {
+	src := c.activeConfig.Source
+	switch src.Kind {
+	case sun.SourceMoon:
+		pos := suncalc.GetMoonPosition(t, c.activeConfig.Location.Lat, c.activeConfig.Location.Long)
+		return pos.Azimuth, pos.Altitude
+	case sun.SourceFixed:
+		return src.Direction.Azimuth, src.Direction.Altitude
+	}
+	return c.sunPosition(t)
+}
+
+// directTracker reports if the device's normal points straight at the source, rather than reflecting it onto the target
+func (c *Controller) directTracker() bool {
+	return c.activeConfig.Device == sun.DeviceTracker
+}
+
+// sourceKind returns the kind of light source being reflected
+func (c *Controller) sourceKind() string {
+	if c.activeConfig.Source.Kind == "" {
+		return sun.SourceSun
+	}
+	return c.activeConfig.Source.Kind
+}
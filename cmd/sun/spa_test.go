@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// the example from the SPA report, table A5.1: 17 October 2003 12:30:30 at UTC-7, Golden, Colorado
+func TestSPA(tt *testing.T) {
+	t := time.Date(2003, 10, 17, 12, 30, 30, 0, time.FixedZone("MST", -7*60*60))
+	res := spaPosition(t, 67, 39.742476, -105.1786, 1830.14, 820, 11)
+	cases := []struct {
+		name   string
+		got    float64
+		expect float64
+		tol    float64
+	}{
+		{"julian day", res.jd, 2452930.312847, 1e-6},
+		{"L", res.l, 24.0182616917, 1e-6},
+		{"B", res.b, -0.0001011219, 1e-9},
+		{"R", res.r, 0.9965422974, 1e-9},
+		{"H", res.h, 11.10590276, 1e-5},
+		{"delta psi", res.dPsi, -0.00399840, 1e-7},
+		{"delta epsilon", res.dEpsilon, 0.00166657, 1e-7},
+		{"epsilon", res.epsilon, 23.440465, 1e-6},
+		{"alpha", res.alpha, 202.22741, 1e-5},
+		{"delta", res.delta, -9.31434, 1e-5},
+		{"zenith", res.zenith, 50.11162, 1e-5},
+		{"azimuth", res.azimuth, 194.34024 - 180, 1e-5}, //the report's azimuth is from north
+	}
+	for _, c := range cases {
+		if math.Abs(c.got-c.expect) > c.tol {
+			tt.Errorf("Error with TestSPA, %v... Got: %.10f expected: %.10f", c.name, c.got, c.expect)
+		}
+	}
+}
+
+func TestEphemerisAgree(tt *testing.T) {
+	loc := auckland
+	t := time.Date(2023, 1, 2, 15, 0, 0, 0, nz)
+	a := suncalcEphemeris{}.SunPosition(t, loc)
+	b := newEphemeris(types.Ephemeris{Algorithm: types.EphemerisSPA}).SunPosition(t, loc)
+	if d := radToDeg(angleBetween(a.Azimuth, a.Altitude, b.Azimuth, b.Altitude)); d > 0.1 {
+		tt.Errorf("Error with TestEphemerisAgree... Got: %.4f degrees apart expected: less than 0.1", d)
+	}
+}
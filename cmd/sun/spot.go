@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+const defaultSourceDiameter = 0.0093 // radians, the sun and the moon are both about half a degree across
+
+// estimateSpot estimates the reflected spot on the target's surface. The beam leaves the mirror(normal) the size of the mirror
+// as seen from the target, and spreads by the source's angular diameter on the way. Where it lands is found by following the
+// beam to the target's plane, which faces plane(nil for facing the mirror). dist is the target's distance in metres from the
+// pivot, the beam leaves from the mirror's centre, offset metres in front of the pivot
+func estimateSpot(source sun.Direction, normal sun.Direction, target sun.Direction, dist float64, offset float64, plane *sun.Direction, m sun.Mirror, diameter float64) (sun.Spot, error) {
+	if dist <= 0 {
+		return sun.Spot{}, fmt.Errorf("target distance unknown, give the target as a point or set target.distance")
+	}
+	//reflect the source in the mirror
+	s := vector(source)
+	n := vector(normal)
+	dot := s[0]*n[0] + s[1]*n[1] + s[2]*n[2]
+	if dot <= 0 {
+		return sun.Spot{}, fmt.Errorf("the source is behind the mirror")
+	}
+	r := [3]float64{2*dot*n[0] - s[0], 2*dot*n[1] - s[1], 2*dot*n[2] - s[2]}
+
+	//the target as seen from the mirror's centre
+	ox, oy, oz := toCartesianCoords(normal.Azimuth, normal.Altitude, offset)
+	tx, ty, tz := toCartesianCoords(target.Azimuth, target.Altitude, dist)
+	a := [3]float64{tx - ox, ty - oy, tz - oz}
+	//the target's plane, by default square on to the mirror
+	aLen := math.Sqrt(a[0]*a[0] + a[1]*a[1] + a[2]*a[2])
+	if aLen < 1e-9 {
+		return sun.Spot{}, fmt.Errorf("the target is on the mirror")
+	}
+	p := [3]float64{-a[0] / aLen, -a[1] / aLen, -a[2] / aLen}
+	if plane != nil {
+		p = vector(*plane)
+	}
+	cosHit := -(r[0]*p[0] + r[1]*p[1] + r[2]*p[2])
+	if cosHit < 0.01 {
+		return sun.Spot{}, fmt.Errorf("the beam doesn't reach the face of the target")
+	}
+	//where the beam meets the plane, relative to the target
+	k := -(a[0]*p[0] + a[1]*p[1] + a[2]*p[2]) / cosHit
+	off := [3]float64{k*r[0] - a[0], k*r[1] - a[1], k*r[2] - a[2]}
+	//the plane's horizontal(right, looking at its face) and up directions
+	right := [3]float64{p[1], -p[0], 0}
+	if l := math.Hypot(right[0], right[1]); l > 1e-9 {
+		right[0], right[1] = right[0]/l, right[1]/l
+	} else {
+		right = [3]float64{0, 1, 0} //the plane is horizontal, right is west
+	}
+	up := [3]float64{right[1]*p[2] - right[2]*p[1], right[2]*p[0] - right[0]*p[2], right[0]*p[1] - right[1]*p[0]}
+
+	//size, the mirror's area seen along the beam as a circle, plus the spread of the source
+	incidence := math.Acos(math.Min(1, dot))
+	d := math.Sqrt(4*m.Width*m.Height*math.Cos(incidence)/math.Pi) + k*diameter
+	return sun.Spot{
+		Distance:    k,
+		Width:       d,
+		Length:      d / cosHit,
+		Area:        math.Pi / 4 * d * d / cosHit,
+		BeamError:   angleBetweenVectors(r, a),
+		Offset:      math.Sqrt(off[0]*off[0] + off[1]*off[1] + off[2]*off[2]),
+		OffsetRight: off[0]*right[0] + off[1]*right[1] + off[2]*right[2],
+		OffsetUp:    off[0]*up[0] + off[1]*up[1] + off[2]*up[2],
+	}, nil
+}
+
+// spotAt estimates the spot at time t. At the current time it's with the mirror where it was last sent(or where it
+// should be before it's been moved), at any other time it's with the mirror where tracking would have put it
+func (c *Controller) spotAt(t time.Time) (sun.Spot, error) {
+	if c.directTracker() {
+		return sun.Spot{}, fmt.Errorf("a tracker doesn't reflect a spot")
+	}
+	g := c.desiredGeometry(t)
+	normal := g.normal
+	if c.haveCommanded && t.Equal(c.cTime()) {
+		normal = c.axesDirection(c.commanded)
+	}
+	diameter := c.activeConfig.Source.Diameter
+	if diameter == 0 && c.sourceKind() != sun.SourceFixed {
+		diameter = defaultSourceDiameter
+	}
+	spot, err := estimateSpot(g.source, normal, g.target, g.dist, c.activeConfig.Mount.MirrorOffset, c.activeConfig.Target.Plane, c.activeConfig.Mirror, diameter)
+	spot.Time = t
+	return spot, err
+}
+
+func vector(d sun.Direction) [3]float64 {
+	x, y, z := toCartesianCoords(d.Azimuth, d.Altitude, 1.0)
+	return [3]float64{x, y, z}
+}
+
+func angleBetweenVectors(a [3]float64, b [3]float64) float64 {
+	aAzi, aAlt, _ := toSphericalCoords(a[0], a[1], a[2])
+	bAzi, bAlt, _ := toSphericalCoords(b[0], b[1], b[2])
+	return angleBetween(aAzi, aAlt, bAzi, bAlt)
+}
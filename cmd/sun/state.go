@@ -6,14 +6,70 @@ import (
 	"github.com/mykldog7/heliostat2/pkg/types"
 )
 
+// State is a snapshot of the controller, published after every update and command, and on request (GetState)
 type State struct {
 	Config   *types.Config `json:"config"`
 	Time     time.Time     `json:"time"`
 	Position struct {
 		Elevation float64 `json:"ele"`
 		Azimuth   float64 `json:"azi"`
-	} `json:"pos"`
-	Connected bool          `json:"connected"`
-	Enabled   bool          `json:"enabled"`
-	Uptime    time.Duration `json:"uptime"`
+	} `json:"pos"` // where the mirror's normal was last sent, radians
+	Connected    bool                     `json:"connected"`
+	Enabled      bool                     `json:"enabled"` // are moves being sent
+	Uptime       time.Duration            `json:"uptime"`
+	Mode         types.OperatingMode      `json:"mode"`
+	Sun          types.Direction          `json:"sun"`
+	Source       string                   `json:"source"`          // the light being reflected, "sun", "moon" or "fixed"
+	SourceDir    types.Direction          `json:"source_dir"`      // direction of the light being reflected
+	Target       types.Direction          `json:"target"`          // direction of the target from the mirror
+	Distance     float64                  `json:"target_distance"` // metres, 0 if the target is only a direction
+	Mirror       types.Direction          `json:"mirror"`          // where the mirror's normal needs to be
+	Axes         axes                     `json:"axes"`            // last position sent to grbl, degrees
+	Grbl         string                   `json:"grbl"`            // last status report from grbl
+	ActiveRule   types.ActiveRule         `json:"active_rule"`
+	Latency      types.LatencyStatus      `json:"latency"`
+	UpdatePeriod types.UpdatePeriodStatus `json:"update_period"`
+	Reachability types.Reachability       `json:"reachability"`
+	DayPhase     string                   `json:"day_phase"`
+	Optics       types.Optics             `json:"optics"`
+	Spot         *types.Spot              `json:"spot,omitempty"` // nil when it can't be estimated, e.g. the target distance is unknown
+}
+
+// snapshot returns the current State of the controller
+func (c *Controller) snapshot() State {
+	cfg := c.activeConfig
+	s := State{
+		Config:       &cfg,
+		Time:         c.cTime(),
+		Connected:    c.grbl.Connected(),
+		Enabled:      c.opMode == types.Tracking || c.opMode == types.Parked || c.opMode == types.Stowed,
+		Uptime:       time.Since(c.started),
+		Mode:         c.opMode,
+		Mirror:       c.desired,
+		Axes:         c.commanded,
+		Grbl:         c.grbl.LastStatus(),
+		ActiveRule:   c.activeRuleInfo(),
+		Latency:      c.latencyStatus(),
+		UpdatePeriod: c.periodStatus(),
+		Reachability: c.reachability,
+		DayPhase:     dayPhase(c.cTime(), c.activeConfig.Location),
+		Optics:       c.optics,
+	}
+	s.Sun.Azimuth, s.Sun.Altitude = c.sunPosition(s.Time)
+	s.Source = c.sourceKind()
+	s.SourceDir.Azimuth, s.SourceDir.Altitude = c.sourcePosition(s.Time)
+	s.Target, s.Distance = c.targetDirection()
+	if spot, err := c.spotAt(s.Time); err == nil {
+		s.Spot = &spot
+	}
+	if c.haveCommanded {
+		pos := c.axesDirection(c.commanded)
+		s.Position.Azimuth, s.Position.Elevation = pos.Azimuth, pos.Altitude
+	}
+	return s
+}
+
+// publishState sends a snapshot of the controller to all clients
+func (c *Controller) publishState() {
+	c.publish <- types.NewMessage("State", c.snapshot())
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+	"github.com/sixdouglas/suncalc"
+)
+
+// altitudes(radians) of the sun at sunrise/sunset and dawn/dusk, as used by suncalc
+var (
+	sunriseAltitude = degToRad(-0.833)
+	dawnAltitude    = degToRad(-6)
+)
+
+// sunEvents returns the times of the sun's events on the date of day, at loc
+func sunEvents(day time.Time, loc sun.Location) sun.SunEvents {
+	y, m, d := day.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, day.Location())
+	times := suncalc.GetTimes(noon, loc.Lat, loc.Long)
+	at := func(name suncalc.DayTimeName) time.Time { return times[name].Value.In(day.Location()) }
+	return sun.SunEvents{
+		Date:      day.Format("2006-01-02"),
+		Location:  loc,
+		Dawn:      at(suncalc.Dawn),
+		Sunrise:   at(suncalc.Sunrise),
+		SolarNoon: at(suncalc.SolarNoon),
+		Sunset:    at(suncalc.Sunset),
+		Dusk:      at(suncalc.Dusk),
+	}
+}
+
+// dayPhase returns the phase of the day at t, from the day's sun events. Where the sun doesn't rise or set(or dawn/dusk
+// don't happen) it's decided by the sun's altitude
+func dayPhase(t time.Time, loc sun.Location) string {
+	e := sunEvents(t, loc)
+	if eventsValid(e) {
+		switch {
+		case t.Before(e.Dawn) || !t.Before(e.Dusk):
+			return sun.PhaseNight
+		case t.Before(e.Sunrise):
+			return sun.PhaseDawn
+		case t.Before(e.Sunset):
+			return sun.PhaseDay
+		}
+		return sun.PhaseDusk
+	}
+	alt := suncalc.GetPosition(t, loc.Lat, loc.Long).Altitude
+	switch {
+	case alt > sunriseAltitude:
+		return sun.PhaseDay
+	case alt <= dawnAltitude:
+		return sun.PhaseNight
+	case t.Before(e.SolarNoon):
+		return sun.PhaseDawn
+	}
+	return sun.PhaseDusk
+}
+
+// eventsValid reports if all the events happen, suncalc returns nonsense times for events that don't
+func eventsValid(e sun.SunEvents) bool {
+	for _, t := range []time.Time{e.Dawn, e.Sunrise, e.Sunset, e.Dusk} {
+		if d := t.Sub(e.SolarNoon); d < -12*time.Hour || d > 12*time.Hour {
+			return false
+		}
+	}
+	return e.Dawn.Before(e.Sunrise) && e.Sunset.Before(e.Dusk)
+}
+
+// checkSunEvents publishes the sun's events when the day or the location changes
+func (c *Controller) checkSunEvents() {
+	t := c.cTime()
+	loc := c.activeConfig.Location
+	if c.sunEvents.Date == t.Format("2006-01-02") && c.sunEvents.Location == loc {
+		return
+	}
+	c.sunEvents = sunEvents(t, loc)
+	e := c.sunEvents
+	log.Printf("Sun events for %v: sunrise %v, solar noon %v, sunset %v", e.Date, e.Sunrise.Format("15:04"), e.SolarNoon.Format("15:04"), e.Sunset.Format("15:04"))
+	c.publish <- sun.NewMessage("SunEvents", e)
+}
+
+// validPhase reports if p is one of the day phases
+func validPhase(p string) bool {
+	return p == sun.PhaseNight || p == sun.PhaseDawn || p == sun.PhaseDay || p == sun.PhaseDusk
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	sun "github.com/mykldog7/heliostat2/pkg/types"
+)
+
+// targetSlew moves the target gradually towards a new position
+type targetSlew struct {
+	to   sun.Direction
+	rate float64   // radians per second
+	last time.Time // when the target was last stepped
+}
+
+// parseSetTarget converts a SetTarget request to radians, checking it is a sensible target
+func parseSetTarget(st sun.SetTarget) (sun.Direction, float64, error) {
+	var scale float64
+	switch st.Units {
+	case "deg":
+		scale = math.Pi / 180.0
+	case "rad":
+		scale = 1.0
+	default:
+		return sun.Direction{}, 0, fmt.Errorf("units must be \"deg\" or \"rad\", got %q", st.Units)
+	}
+	for _, v := range []float64{st.Azimuth, st.Altitude, st.SlewRate} {
+		if !finite(v) {
+			return sun.Direction{}, 0, fmt.Errorf("target values must be finite numbers")
+		}
+	}
+	t := sun.Direction{Azimuth: st.Azimuth * scale, Altitude: st.Altitude * scale}
+	if t.Altitude < 0 || t.Altitude > math.Pi/2 {
+		return sun.Direction{}, 0, fmt.Errorf("altitude must be between the horizon and vertical, got %v %v", st.Altitude, st.Units)
+	}
+	if st.SlewRate < 0 {
+		return sun.Direction{}, 0, fmt.Errorf("slew rate can't be negative")
+	}
+	t.Azimuth = math.Remainder(t.Azimuth, 2*math.Pi) //wrap around the circle
+	return t, st.SlewRate * scale, nil
+}
+
+// slewTarget steps the target towards the slew's destination, by the rate for the time since the last step
+func (c *Controller) slewTarget() {
+	if c.slew == nil {
+		return
+	}
+	now := time.Now()
+	step := c.slew.rate * now.Sub(c.slew.last).Seconds()
+	c.slew.last = now
+	t := &c.activeConfig.Target.Direction
+	dAzi := math.Remainder(c.slew.to.Azimuth-t.Azimuth, 2*math.Pi) //the short way round
+	dAlt := c.slew.to.Altitude - t.Altitude
+	dist := math.Hypot(dAzi, dAlt)
+	if dist <= step {
+		*t = c.slew.to
+		c.slew = nil
+		log.Printf("Target slew complete")
+		c.persistConfig()
+		return
+	}
+	t.Azimuth = math.Remainder(t.Azimuth+dAzi*step/dist, 2*math.Pi)
+	t.Altitude += dAlt * step / dist
+}
+
+// targetDirection returns the direction of the target from the mirror's pivot, and its distance in metres(0 when unknown)
+func (c *Controller) targetDirection() (sun.Direction, float64) {
+	t := c.activeConfig.Target
+	switch {
+	case t.Local != nil:
+		return enuToDirection(*t.Local)
+	case t.Geodetic != nil:
+		return enuToDirection(geodeticToENU(*t.Geodetic, c.activeConfig.Location))
+	}
+	return t.Direction, t.Distance
+}
+
+// useDirectionTarget replaces a target given as a point with its direction, ready for the direction to be adjusted
+func (c *Controller) useDirectionTarget() {
+	t := &c.activeConfig.Target
+	if t.Local == nil && t.Geodetic == nil {
+		return
+	}
+	t.Direction, t.Distance = c.targetDirection()
+	t.Local, t.Geodetic = nil, nil
+	log.Printf("Target point replaced by its direction (azi, alt) %.3f, %.3f", radToDeg(t.Azimuth), radToDeg(t.Altitude))
+}
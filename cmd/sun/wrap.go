@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"math"
+)
+
+// positionNear returns the axes position(degrees) the next move should stay closest to. Usually that's where the axes are now,
+// taking the shortest way round, but when the cable is wound past the unwind point and it's night we head back towards zero azimuth
+func (c *Controller) positionNear() axes {
+	if !c.haveCommanded {
+		return axes{}
+	}
+	unwindAt := c.activeConfig.Mount.UnwindAt
+	if unwindAt > 0 && math.Abs(c.commanded.Azi) > radToDeg(unwindAt) && c.isNight() {
+		log.Printf("Azimuth at %.1f degrees, unwinding", c.commanded.Azi)
+		return axes{Azi: 0.0, Alt: c.commanded.Alt}
+	}
+	return c.commanded
+}
+
+// isNight reports if the sun is below the horizon, the mirror isn't doing anything useful so it's a safe time for long moves
+func (c *Controller) isNight() bool {
+	_, alt := c.sunPosition(c.cTime())
+	return alt < 0
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 
 	"github.com/gdamore/tcell/v2"
 	sun "github.com/mykldog7/heliostat2/pkg/types"
@@ -45,6 +46,12 @@ func adjustTargetEventHandler(e *tcell.EventKey) *tcell.EventKey {
 			currentMoveSize *= 0.5
 			notes.SetText(fmt.Sprintf("Move size(degrees): %v", radToDeg(currentMoveSize)))
 			return nil
+		case 'f':
+			//the position form follows the buttons in the details pane
+			if details.GetItemCount() > 1 {
+				app.SetFocus(details.GetItem(1))
+			}
+			return nil
 		default:
 			return e
 		}
@@ -59,3 +66,29 @@ func updateTarget(dir string, amount float64) error {
 	toServer <- sun.Message{T: "MoveTargetRelative", D: payload_bytes}
 	return nil
 }
+
+// setTarget sends an absolute target(in degrees, as typed) to the server, slewing to it if a rate is given
+func setTarget(azi string, alt string, slew string) error {
+	payload := sun.SetTarget{Units: "deg"}
+	var err error
+	payload.Azimuth, err = strconv.ParseFloat(azi, 64)
+	if err != nil {
+		return fmt.Errorf("azimuth must be a number")
+	}
+	payload.Altitude, err = strconv.ParseFloat(alt, 64)
+	if err != nil {
+		return fmt.Errorf("altitude must be a number")
+	}
+	if payload.Altitude < 0 || payload.Altitude > 90 {
+		return fmt.Errorf("altitude must be between 0 and 90")
+	}
+	if slew != "" {
+		payload.SlewRate, err = strconv.ParseFloat(slew, 64)
+		if err != nil || payload.SlewRate < 0 {
+			return fmt.Errorf("slew rate must be a positive number")
+		}
+	}
+	payload_bytes, _ := json.Marshal(payload)
+	toServer <- sun.Message{T: "SetTarget", D: payload_bytes}
+	return nil
+}
@@ -22,7 +22,7 @@ func StartInterface() error {
 	//actions available in the main menu
 	actions = tview.NewList().
 		AddItem("Quit", "close app", 'q', func() { app.Stop() }).
-		AddItem("Adjust Target", "move the target with w,a,s,d. adjust step with '<', '>'", 'm', displayAdjustTarget).
+		AddItem("Adjust Target", "move the target with w,a,s,d. adjust step with '<', '>', 'f' to enter a position", 'm', displayAdjustTarget).
 		AddItem("Adjust Lat/Long", "set the mirror lat, long", 'l', displayLatLong).
 		AddItem("Configure Time", "override the machine time", 'o', displayAdjustTime)
 	actions.SetBorder(true).SetTitle("Available Actions")
@@ -70,6 +70,7 @@ func displayAdjustTarget() {
 	//update displayed elements in details pane
 	details.Clear()
 	details.SetTitle(selectedAction)
+	details.SetDirection(tview.FlexRow)
 	options := tview.NewTable().SetBorders(false)
 	options.SetTitle("Press Buttons to Adjust").SetTitleColor(tcell.ColorForestGreen)
 	options.SetBorder(true)
@@ -79,11 +80,35 @@ func displayAdjustTarget() {
 	options.SetCell(1, 2, tview.NewTableCell("(d) RIGHT").SetBackgroundColor(tcell.ColorDarkBlue))
 	options.SetCell(4, 0, tview.NewTableCell("(<) Inc").SetBackgroundColor(tcell.ColorDarkBlue))
 	options.SetCell(4, 2, tview.NewTableCell("(>) Dec").SetBackgroundColor(tcell.ColorDarkBlue))
+	options.SetCell(5, 1, tview.NewTableCell("(f) Enter Position").SetBackgroundColor(tcell.ColorDarkBlue))
 
-	details.SetInputCapture(adjustTargetEventHandler)
+	//form to type in an exact target, in degrees
+	azi, alt, slew := "", "", ""
+	if config != nil {
+		azi = fmt.Sprintf("%.2f", radToDeg(config.Target.Azimuth))
+		alt = fmt.Sprintf("%.2f", radToDeg(config.Target.Altitude))
+	}
+	position := tview.NewForm().
+		AddInputField("Azimuth(deg)", azi, 10, tview.InputFieldFloat, func(t string) { azi = t }).
+		AddInputField("Altitude(deg)", alt, 10, tview.InputFieldFloat, func(t string) { alt = t }).
+		AddInputField("Slew(deg/s)", slew, 10, tview.InputFieldFloat, func(t string) { slew = t })
+	position.AddButton("Set", func() {
+		err := setTarget(azi, alt, slew)
+		if err != nil {
+			notes.SetText(fmt.Sprintf("Can't set target: %v", err))
+			return
+		}
+		notes.SetText(fmt.Sprintf("Target set to azimuth %v, altitude %v (degrees)", azi, alt))
+		app.SetFocus(options)
+	})
+	position.SetBorder(true).SetTitle("Enter Position")
+
+	options.SetInputCapture(adjustTargetEventHandler)
+	details.SetInputCapture(nil)
 	details.AddItem(options, 0, 1, true)
+	details.AddItem(position, 0, 1, false)
 
-	app.SetFocus(details)
+	app.SetFocus(options)
 }
 
 func displayLatLong() {
@@ -91,6 +116,7 @@ func displayLatLong() {
 	selectedAction, _ = actions.GetItemText(actions.GetCurrentItem())
 	//update displayed elements in details pane
 	details.Clear()
+	details.SetDirection(tview.FlexColumn)
 	details.SetTitle(selectedAction)
 	options := tview.NewForm().
 		AddTextArea("Lat", "", 25, 1, 25, func(t string) {}).
@@ -105,6 +131,7 @@ func displayAdjustTime() {
 	selectedAction, _ = actions.GetItemText(actions.GetCurrentItem())
 	//update displayed elements in details pane
 	details.Clear()
+	details.SetDirection(tview.FlexColumn)
 	details.SetTitle(selectedAction)
 	options := tview.NewForm().
 		AddTextArea("Time", "dd/mm/yyyy", 25, 1, 25, func(t string) {})
@@ -41,13 +41,27 @@ func StartConnection(address string, unlockUI *sync.Mutex) error {
 			}
 			switch msg.T {
 			case "ActiveConfig":
-				err = json.Unmarshal(d, config) //unmarshal into global config, yikes!
+				cfg := sun.Config{}
+				err = json.Unmarshal(msg.D, &cfg)
 				if err != nil {
 					errC <- err
 				}
+				config = &cfg //replace the global config, yikes!
 				//log.Printf("got activeConfig: %v", string(d))
 			case "Ack":
 				//log.Printf("got ack: %v", string(d))
+			case "Mode":
+				mode := sun.ModeStatus{}
+				if json.Unmarshal(msg.D, &mode) == nil {
+					showNote(fmt.Sprintf("Mode: %v (%v)", mode.Mode, mode.Reason))
+				}
+			case "Status":
+				status := sun.Status{}
+				if json.Unmarshal(msg.D, &status) == nil {
+					showNote(status.Message)
+				}
+			case "State", "Reposition", "ActiveRule", "Reachability", "SunEvents":
+				//published to every client, not displayed yet
 			default:
 				log.Printf("got unknown message type: %v with data: %v", msg.T, string(d))
 			}
@@ -81,3 +95,11 @@ func StartConnection(address string, unlockUI *sync.Mutex) error {
 
 	return <-errC //pass-up if either goroutine to return an error
 }
+
+// showNote displays a message from the server in the notes area, safe to call from outside the ui goroutine
+func showNote(text string) {
+	if app == nil || notes == nil {
+		return
+	}
+	app.QueueUpdateDraw(func() { notes.SetText(text) })
+}
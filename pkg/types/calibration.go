@@ -0,0 +1,40 @@
+package types
+
+import "time"
+
+// Calibration is a pointing model for the mount, fitted to observations of the reflection landing on the target.
+// It corrects for misalignment that the azimuth/altitude offsets alone can't, e.g. a tilted base
+type Calibration struct {
+	Enabled      bool          `json:"enabled"`
+	Model        PointingModel `json:"model"`
+	Observations []Observation `json:"observations"`
+}
+
+// PointingModel terms, in radians. The axes are corrected by
+// azimuth: AziZero + NonPerp*tan(alt) + TiltA*sin(azi)*tan(alt) - TiltB*cos(azi)*tan(alt)
+// altitude: AltZero + TiltA*cos(azi) + TiltB*sin(azi)
+type PointingModel struct {
+	AziZero float64   `json:"azi_zero"` // zero position error of the azimuth axis
+	AltZero float64   `json:"alt_zero"` // zero position error of the altitude axis
+	TiltA   float64   `json:"tilt_a"`   // base tilt, towards south
+	TiltB   float64   `json:"tilt_b"`   // base tilt, towards west
+	NonPerp float64   `json:"non_perp"` // how far the axes are from perpendicular
+	RMS     float64   `json:"rms"`      // residual error of the fit
+	Fitted  time.Time `json:"fitted"`
+}
+
+// Observation records where the axes were when the operator confirmed the reflection was on the target
+type Observation struct {
+	Time    time.Time `json:"time"`
+	Sun     Direction `json:"sun"`
+	Target  Direction `json:"target"`
+	Mirror  Direction `json:"mirror"`   // the mirror normal that puts the reflection on the target
+	AxesAzi float64   `json:"axes_azi"` // degrees, as sent to grbl
+	AxesAlt float64   `json:"axes_alt"`
+}
+
+// Used in manual mode to move the axes directly, in degrees
+type JogAxes struct {
+	Azimuth  float64 `json:"azi"`
+	Altitude float64 `json:"alt"`
+}
@@ -7,21 +7,154 @@ import (
 
 // Config is used to store the core configuration of the heliostat at the present time.
 type Config struct {
-	TimeProgression float64   `json:"progression_factor"`
-	OverrideTime    time.Time `json:"override_time"` // the 'sim' or override time
-	Location        Location  `json:"loc"`
-	AziOffset       float64   `json:"azimuth_offset"`
-	AltOffset       float64   `json:"altitude_offset"` //If the mirror is not facing true south, at horison, in the zero position, use these offsets to adjust
-	Target          struct {
-		Altitude float64 `json:"alt"`
-		Azimuth  float64 `json:"azi"`
-	} `json:"target"`
+	TimeProgression float64        `json:"progression_factor"`
+	OverrideTime    time.Time      `json:"override_time"` // the 'sim' or override time
+	Location        Location       `json:"loc"`
+	AziOffset       float64        `json:"azimuth_offset"`
+	AltOffset       float64        `json:"altitude_offset"` //If the mirror is not facing true south, at horison, in the zero position, use these offsets to adjust
+	Target          Target         `json:"target"`
+	Park            Direction      `json:"park"`     // where the mirror's normal is pointed when parked
+	Stow            Direction      `json:"stow"`     // where the mirror's normal is pointed when stowed, e.g. flat during high winds
+	Schedule        []ScheduleRule `json:"schedule"` // time based rules, the first matching rule is applied
+	Mount           Mount          `json:"mount"`
+	Latency         Latency        `json:"latency"`
+	UpdatePeriod    UpdatePeriod   `json:"update_period"`
+	Unreachable     string         `json:"unreachable_policy"` // what to do when the mirror can't reach the required position
+	Calibration     Calibration    `json:"calibration"`
+	Corrections     Corrections    `json:"corrections"`
+	Ephemeris       Ephemeris      `json:"ephemeris"`
+	Source          Source         `json:"source"`
+	Device          string         `json:"device"` // what's on the mount, DeviceHeliostat(the default) or DeviceTracker
+	Mirror          Mirror         `json:"mirror"`
+}
+
+// Mirror describes the reflector, for estimating its performance and spot
+type Mirror struct {
+	Width        float64 `json:"width"`  // metres
+	Height       float64 `json:"height"` // metres
+	Reflectivity float64 `json:"reflectivity"`
+}
+
+// Devices the mount can carry
+const (
+	DeviceHeliostat = "heliostat" // a mirror, its normal bisects the source and the target
+	DeviceTracker   = "tracker"   // e.g. a PV panel or pyranometer, its normal points straight at the source, the target is unused
+)
+
+// Light sources the mirror can reflect
+const (
+	SourceSun   = "sun"
+	SourceMoon  = "moon"  // dim enough to safely check alignment at night
+	SourceFixed = "fixed" // e.g. a lamp, at Source.Direction
+)
+
+// Source is the light reflected onto the target
+type Source struct {
+	Kind      string    `json:"kind"`     // SourceSun(the default), SourceMoon or SourceFixed
+	Direction Direction `json:"dir"`      // only used with SourceFixed
+	Diameter  float64   `json:"diameter"` // radians, angular size of the source for spot estimates, 0 for the sun/moon's
+}
+
+// Sun position algorithms
+const (
+	EphemerisSunCalc = "suncalc" // quick, about a tenth of a degree, no refraction
+	EphemerisSPA     = "spa"     // NREL's Solar Position Algorithm, +/-0.0003 degrees, with refraction
+)
+
+// Ephemeris selects and configures the algorithm used to find the sun
+type Ephemeris struct {
+	Algorithm   string  `json:"algorithm"`   // EphemerisSunCalc(the default) or EphemerisSPA
+	Pressure    float64 `json:"pressure"`    // mbar, average at the site, for refraction. 0 for no refraction
+	Temperature float64 `json:"temperature"` // celsius, average at the site, for refraction
+	DeltaT      float64 `json:"delta_t"`     // seconds, TT-UT, 0 to estimate it from the date
+}
+
+// Policies for when the mirror can't be moved to where it needs to be
+const (
+	UnreachableBestEffort = "best_effort" // move as close as the mount allows
+	UnreachablePark       = "park"        // move to the park position
+	UnreachableHold       = "hold"        // refuse the move, stay at the last position
+)
+
+// UpdatePeriod bounds how often the mirror is moved, within these bounds the period is chosen so that
+// the mirror drifts no further than MaxError between moves. Leave Max or MaxError as 0 for a fixed period
+type UpdatePeriod struct {
+	Min      time.Duration `json:"min"`
+	Max      time.Duration `json:"max"`
+	MaxError float64       `json:"max_error"` // radians, of the mirror's normal
+}
+
+// Latency configures how far ahead of each update the mirror position is calculated, so the beam doesn't lag the sun
+type Latency struct {
+	Fixed  time.Duration `json:"fixed"`  // expected time for a move to complete, used when not learning(or nothing measured yet)
+	Learn  bool          `json:"learn"`  // measure each move, and estimate the latency from those measurements
+	Settle time.Duration `json:"settle"` // added to the move time, allows the mirror to stop moving
+}
+
+// Mount describes the mechanics of the heliostat
+type Mount struct {
+	AziStepsPerDegree float64 `json:"azi_steps_per_deg"` // match grbl's $100 (grbl's 'mm' are our degrees), 0 to disable quantising
+	AltStepsPerDegree float64 `json:"alt_steps_per_deg"` // match grbl's $101
+	DeadBand          float64 `json:"dead_band"`         // radians, moves where neither axis changes by more than this are skipped
+	AziLimits         Limits  `json:"azi_limits"`        // the cable wrap, may be more than a full turn
+	UnwindAt          float64 `json:"unwind_at"`         // radians, at night an azimuth further than this from zero is unwound, 0 to disable
+	AltLimits         Limits  `json:"alt_limits"`        // for mounts that tilt past vertical Max can be more than PI/2
+	AllowFlip         bool    `json:"allow_flip"`        // allow tilting over the top(azimuth+PI, altitude PI-alt) to avoid limits or shorten moves
+	Base              Base    `json:"base"`
+	MirrorOffset      float64 `json:"mirror_offset"` // metres, from the pivot to the mirror's centre along its normal(positive in front)
+}
+
+// Base is the orientation of the mount's base, in radians, for mounts that aren't level or don't face south.
+// Yaw turns the mount's zero azimuth from south towards west, then pitch tilts the base down on the south side
+// and roll tilts it down on the west side
+type Base struct {
+	Roll  float64 `json:"roll"`
+	Pitch float64 `json:"pitch"`
+	Yaw   float64 `json:"yaw"`
+}
+
+// Limits is the range of travel of an axis, in radians from the axis' zero position. If Max isn't greater than Min the
+// default range is used, azimuth: -PI to PI, altitude: 0(horizon) to PI/2(vertical)
+type Limits struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Direction is a pointing direction in radians, azimuth measured from south towards west, altitude above the horizon
+type Direction struct {
+	Altitude float64 `json:"alt"`
+	Azimuth  float64 `json:"azi"`
 }
 
 // Location stores a particular point on the earths surface
 type Location struct {
-	Lat  float64 `json:"lat"`
-	Long float64 `json:"long"`
+	Lat    float64 `json:"lat"`
+	Long   float64 `json:"long"`
+	Height float64 `json:"height,omitempty"` // metres, of the mirror's pivot above the ellipsoid, only needed for Geodetic targets
+}
+
+// Target is where the reflection should go. Either a direction(azi, alt), or a point: an offset from the mirror's pivot(enu)
+// or a surveyed position(geodetic), in which case the direction is derived from the point
+type Target struct {
+	Direction
+	Distance float64    `json:"distance,omitempty"` // metres, of a direction target, corrects the parallax of a mirror offset from its pivot
+	Plane    *Direction `json:"plane,omitempty"`    // the direction the target's surface faces, for spot estimates. nil for facing the mirror
+	Local    *ENU       `json:"enu,omitempty"`
+	Geodetic *Geodetic  `json:"geodetic,omitempty"`
+}
+
+// ENU is an offset in metres east, north and up
+type ENU struct {
+	East  float64 `json:"e"`
+	North float64 `json:"n"`
+	Up    float64 `json:"u"`
+}
+
+// Geodetic is a position on the WGS84 ellipsoid, in degrees and metres above the ellipsoid
+type Geodetic struct {
+	Lat    float64 `json:"lat"`
+	Long   float64 `json:"long"`
+	Height float64 `json:"height"`
 }
 
 func (c Config) String() string {
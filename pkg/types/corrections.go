@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+// Corrections is a table of target corrections learned from operator nudges, keyed by the sun's position.
+// Each nudge measures the pointing error with the sun where it was, on later days the correction is
+// interpolated from the nearby points and applied automatically
+type Corrections struct {
+	Learn  bool              `json:"learn"`  // record nudges in the table(instead of moving the target), and apply it
+	Radius float64           `json:"radius"` // radians, how far across the sky a point's correction reaches, 0 for the default(10 degrees)
+	Points []CorrectionPoint `json:"points"`
+}
+
+// CorrectionPoint is the correction(radians) added to the target direction, with the sun at Sun
+type CorrectionPoint struct {
+	Sun      Direction `json:"sun"`
+	Azimuth  float64   `json:"azi"`
+	Altitude float64   `json:"alt"`
+	Nudges   int       `json:"nudges"` // how many nudges have been merged into the point
+	Updated  time.Time `json:"updated"`
+}
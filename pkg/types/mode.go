@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+// OperatingMode is the state of the controller's state machine, it decides what the controller does on each update
+type OperatingMode string
+
+const (
+	Initialising OperatingMode = "initialising" // starting up, nothing has been sent to the mount yet
+	Homing       OperatingMode = "homing"       // setting the mount's current position as the zero position
+	Tracking     OperatingMode = "tracking"     // following the sun, reflecting onto the target
+	Manual       OperatingMode = "manual"       // automatic moves suspended, the operator is in control
+	Parked       OperatingMode = "parked"       // holding at the park position
+	Stowed       OperatingMode = "stowed"       // holding at the stow position, e.g. to ride out bad weather
+	Faulted      OperatingMode = "faulted"      // something went wrong, no moves until the mount is homed again
+	Stopped      OperatingMode = "stopped"      // the controller has shut down
+)
+
+// Request a change of operating mode, answered with an Ack giving the reason when the change is rejected
+type RequestMode struct {
+	Mode OperatingMode `json:"mode"`
+}
+
+// sent whenever the operating mode changes, or on request (GetMode)
+type ModeStatus struct {
+	Mode     OperatingMode `json:"mode"`
+	Previous OperatingMode `json:"previous"`
+	Reason   string        `json:"reason"` // why the current mode was entered
+	Since    time.Time     `json:"since"`
+}
@@ -0,0 +1,29 @@
+package types
+
+// Modes that a ScheduleRule can select
+const (
+	ModeTarget = "target" // reflect the sun onto a target
+	ModePark   = "park"   // move the mirror to the park position and hold it there
+	ModeIdle   = "idle"   // leave the mirror where it is, no moves are sent
+)
+
+// ScheduleRule selects what the heliostat should be doing during a window of the day.
+// e.g. {"name":"kitchen","start":{"event":"sunrise"},"end":{"clock":"11:30"},"mode":"target","target":{"alt":0.1,"azi":-1.2}}
+type ScheduleRule struct {
+	Name     string    `json:"name"`
+	Start    TimeOfDay `json:"start"`
+	End      TimeOfDay `json:"end"`                // if End is before Start the window runs past midnight
+	Weekdays []string  `json:"weekdays,omitempty"` // "mon", "tue", ... empty means every day
+	From     string    `json:"from,omitempty"`     // first date the rule applies (yyyy-mm-dd), empty is unbounded
+	Until    string    `json:"until,omitempty"`    // last date the rule applies (yyyy-mm-dd), empty is unbounded
+	Phases   []string  `json:"phases,omitempty"`   // day phases the rule applies in, e.g. "night", empty means any. Start and End can be left out
+	Mode     string    `json:"mode"`               // one of ModeTarget, ModePark, ModeIdle
+	Target   *Target   `json:"target,omitempty"`   // target selected when the rule becomes active, only used with ModeTarget
+}
+
+// TimeOfDay is either a wall clock time, or a sun event (as named by suncalc, e.g. "sunrise", "solarNoon") plus an offset
+type TimeOfDay struct {
+	Clock  string  `json:"clock,omitempty"` // "hh:mm" in local time
+	Event  string  `json:"event,omitempty"`
+	Offset float64 `json:"offset_min,omitempty"` // minutes after(or before if negative) the event
+}
@@ -28,6 +28,20 @@ type MoveTargetRelative struct {
 	Amount    float64 `json:"radians"`
 }
 
+// Inclinometer is a reading of the mount base's level, in radians, see Base
+type Inclinometer struct {
+	Roll  float64 `json:"roll"`
+	Pitch float64 `json:"pitch"`
+}
+
+// Used to set the target to an absolute position, optionally slewing to it gradually
+type SetTarget struct {
+	Azimuth  float64 `json:"azi"`                 // measured from south towards west
+	Altitude float64 `json:"alt"`                 // above the horizon
+	Units    string  `json:"units"`               // "deg" or "rad", required so there's no confusion
+	SlewRate float64 `json:"slew_rate,omitempty"` // units per second, 0 moves the target straight away
+}
+
 // Provide an immediate 'override' time to the system(it should have its own internal clock, but this can override that)
 type SetTime struct {
 	Time time.Time `json:"datetime"`
@@ -47,15 +61,31 @@ type SetUpdateFreq struct {
 
 // outgoing signals (to be sent to the client, status updates, etc)
 type Ack struct {
-	Success bool `json:"success"`
+	Success bool     `json:"success"`
+	Reason  string   `json:"reason,omitempty"`  // explains a failure
+	Changed []string `json:"changed,omitempty"` // the config fields updated, see UpdateConfig
 }
 
 // NewAckMessage creates a new response message(with status) ready to be sent directly to the client
 // This is used to respond to incoming messages, with a success=true, fail=false
 func NewAckMessage(s bool) []byte {
-	v := Ack{Success: s}
-	ack, _ := json.Marshal(v)
-	m := Message{T: "Ack", D: ack}
+	return NewAckReasonMessage(s, "")
+}
+
+// NewAckReasonMessage is the same as NewAckMessage, but also explains why
+func NewAckReasonMessage(s bool, reason string) []byte {
+	return NewMessage("Ack", Ack{Success: s, Reason: reason})
+}
+
+// NewAckFieldsMessage is a successful ack listing the config fields that were updated
+func NewAckFieldsMessage(changed []string) []byte {
+	return NewMessage("Ack", Ack{Success: true, Changed: changed})
+}
+
+// NewMessage wraps the given value in a Message of type t, ready to be sent directly to the client
+func NewMessage(t string, v any) []byte {
+	payload, _ := json.Marshal(v)
+	m := Message{T: t, D: payload}
 	msg, _ := json.Marshal(m)
 	return msg
 }
@@ -70,9 +100,74 @@ type TargetPosition struct {
 
 // sent whenever the mirror repositions
 type Reposition struct {
+	Time      time.Time     `json:"time"`
+	Azimuth   float64       `json:"azi"` // where the mirror's normal was sent, radians
+	Elevation float64       `json:"ele"`
+	GCode     string        `json:"gcode"`
+	Response  string        `json:"response"` // from grbl
+	Duration  time.Duration `json:"duration"` // until grbl accepted the move
+}
+
+// sent whenever the schedule switches rule, or on request (GetActiveRule)
+type ActiveRule struct {
+	Index int    `json:"index"` // position in Config.Schedule, -1 when no rule applies
+	Name  string `json:"name"`
+	Mode  string `json:"mode"`
+}
+
+// sent on request (GetLatency), details how far ahead the mirror position is being calculated
+type LatencyStatus struct {
+	LookAhead time.Duration `json:"look_ahead"` // in controller time, i.e. scaled when time is simulated
+	Estimate  time.Duration `json:"estimate"`   // learned from measured moves
+	LastMove  time.Duration `json:"last_move"`
+	Samples   int           `json:"samples"`
+	Learning  bool          `json:"learning"`
+}
+
+// sent on request (GetUpdatePeriod), details the period chosen to wait before the next update
+type UpdatePeriodStatus struct {
+	Period     time.Duration `json:"period"`
+	MirrorRate float64       `json:"mirror_rate"` // radians per second(of real time) the mirror is moving
+	Adaptive   bool          `json:"adaptive"`
+}
+
+// sent when the mirror becomes unable(or able again) to reach the position it needs to be in, or on request (GetReachability)
+type Reachability struct {
+	Reachable bool      `json:"reachable"`
+	Shortfall float64   `json:"shortfall,omitempty"` // radians between the required mirror normal and the nearest reachable one
+	Reason    string    `json:"reason,omitempty"`
+	Policy    string    `json:"policy,omitempty"` // the policy applied, see Config.Unreachable
 	Time      time.Time `json:"time"`
-	Azimuth   float64   `json:"azi"`
-	Elevation float64   `json:"ele"`
+}
+
+// sent on request (GetOptics), how effectively the mirror is reflecting the sun onto the target, where it was last sent. Published in the state
+type Optics struct {
+	Time             time.Time `json:"time"`
+	Incidence        float64   `json:"incidence"`         // radians, between the source and the mirror's normal
+	CosineEfficiency float64   `json:"cosine_efficiency"` // cos(incidence), the fraction of the mirror's area facing the source
+	DNI              float64   `json:"dni"`               // W/m², clear sky estimate of the direct irradiance
+	Reflected        float64   `json:"reflected"`         // W/m² of mirror, sent towards the target
+	Power            float64   `json:"power"`             // W, from the whole mirror
+}
+
+// Used to ask for the spot estimate at a time(GetSpot), zero for now
+type GetSpot struct {
+	Time time.Time `json:"time"`
+}
+
+// Spot is an estimate of the reflected spot on the target's surface. For the current time the mirror is where it was
+// last sent, so Offset is how far the spot has drifted since. For any other time the mirror is where tracking would
+// put it(ignoring the mount's limits), so Offset is what tracking leaves, normally close to zero
+type Spot struct {
+	Time        time.Time `json:"time"`
+	Distance    float64   `json:"distance"`     // metres, along the beam to the target's surface
+	Width       float64   `json:"width"`        // metres, across the spot
+	Length      float64   `json:"length"`       // metres, stretched where the beam meets the surface at an angle
+	Area        float64   `json:"area"`         // square metres
+	BeamError   float64   `json:"beam_error"`   // radians, between the reflected beam and the target
+	Offset      float64   `json:"offset"`       // metres, of the spot's centre from the target
+	OffsetRight float64   `json:"offset_right"` // metres, looking at the target's surface
+	OffsetUp    float64   `json:"offset_up"`
 }
 
 type Status struct {
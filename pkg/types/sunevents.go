@@ -0,0 +1,22 @@
+package types
+
+import "time"
+
+// Phases of the day, by the sun's altitude
+const (
+	PhaseNight = "night" // the sun more than 6 degrees below the horizon
+	PhaseDawn  = "dawn"  // morning civil twilight, between dawn and sunrise
+	PhaseDay   = "day"   // between sunrise and sunset
+	PhaseDusk  = "dusk"  // evening civil twilight, between sunset and dusk
+)
+
+// SunEvents are the times of the sun's events for a day at a location, as calculated by suncalc
+type SunEvents struct {
+	Date      string    `json:"date"` // yyyy-mm-dd
+	Location  Location  `json:"loc"`
+	Dawn      time.Time `json:"dawn"`
+	Sunrise   time.Time `json:"sunrise"`
+	SolarNoon time.Time `json:"solar_noon"`
+	Sunset    time.Time `json:"sunset"`
+	Dusk      time.Time `json:"dusk"`
+}